@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/spf13/cobra"
+)
+
+var (
+	businessName  string
+	adminUsername string
+	adminEmail    string
+	adminPassword string
+)
+
+var createBusinessCommand = &cobra.Command{
+	Use:   "business:create",
+	Short: "Create a business with its admin user",
+	Long:  `This command will create a new business (tenant) with an Admin role allowed every module and its first user.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		db := config.GetDB()
+		tx := db.Begin()
+
+		business, role, err := models.CreateBusiness(tx, businessName)
+		if err != nil {
+			tx.Rollback()
+			fmt.Println("Error creating business:", err)
+			return
+		}
+		if _, err := models.CreateBusinessAdmin(tx, business.ID, role.ID, adminUsername, adminEmail, adminPassword); err != nil {
+			tx.Rollback()
+			fmt.Println("Error creating admin user:", err)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println("Business created successfully, id:", business.ID)
+	},
+}
+
+func init() {
+	createBusinessCommand.Flags().StringVar(&businessName, "name", "", "business name")
+	createBusinessCommand.Flags().StringVar(&adminUsername, "admin-username", "", "username of the admin user")
+	createBusinessCommand.Flags().StringVar(&adminEmail, "admin-email", "", "email of the admin user")
+	createBusinessCommand.Flags().StringVar(&adminPassword, "admin-password", "", "password of the admin user")
+	createBusinessCommand.MarkFlagRequired("name")
+	createBusinessCommand.MarkFlagRequired("admin-username")
+	createBusinessCommand.MarkFlagRequired("admin-password")
+
+	rootCmd.AddCommand(createBusinessCommand)
+}
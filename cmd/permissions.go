@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"github.com/spf13/cobra"
+)
+
+var syncPermissionsCommand = &cobra.Command{
+	Use:   "permissions:sync",
+	Short: "Sync modules and actions from the registry",
+	Long:  `This command will upsert the modules declared in code into the modules table and report role module actions that are no longer registered.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		db := config.GetDB()
+		tx := db.Begin()
+
+		report, err := models.SyncModules(tx)
+		if err != nil {
+			tx.Rollback()
+			fmt.Println("Error syncing modules:", err)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := utils.ClearPermissionsCache(report.ChangedRoleIds...); err != nil {
+			fmt.Println("Error clearing permissions cache:", err)
+			return
+		}
+		fmt.Print(report.String())
+		fmt.Println("Modules synced successfully")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncPermissionsCommand)
+}
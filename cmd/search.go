@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/spf13/cobra"
+)
+
+var reindexSearchCommand = &cobra.Command{
+	Use:   "search:reindex",
+	Short: "Rebuild the product search index",
+	Long:  `This command will index every product of every business again into a new product search index and swap it in. Running servers, on every replica, are asked to rebuild their own index and keep serving searches meanwhile.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if err := models.RequestProductReindex(ctx); err != nil {
+			fmt.Println("Error asking running servers to reindex:", err)
+		}
+		count, err := models.ReindexProducts(ctx)
+		if errors.Is(err, config.ErrSearchIndexInUse) {
+			fmt.Println("The product search index here is used by a running server, which rebuilds it")
+			return
+		}
+		if err != nil {
+			fmt.Println("Error reindexing products:", err)
+			return
+		}
+		fmt.Println("Products reindexed successfully:", count)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reindexSearchCommand)
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// key value store behind the redis helpers, selected by CACHE_DRIVER
+type Cache interface {
+	// returns false if the key does not exist or has expired
+	Get(ctx context.Context, key string) (string, bool, error)
+	// exp of 0 keeps the key until it is removed
+	Set(ctx context.Context, key string, value string, exp time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// add one and returns it, a missing key starts at 0
+	Incr(ctx context.Context, key string) (int64, error)
+	Flush(ctx context.Context) error
+	// keys removed together by DeleteTags, exp of 0 keeps the tag until it's deleted
+	Tag(ctx context.Context, tag string, exp time.Duration, keys ...string) error
+	// removes every key of tags
+	DeleteTags(ctx context.Context, tags ...string) error
+}
+
+// backend can't be reached, callers treat it as a miss & go to the database
+var ErrCacheUnavailable = errors.New("cache unavailable")
+
+const (
+	CacheDriverRedis  = "redis"
+	CacheDriverMemory = "memory"
+)
+
+var cache Cache
+
+func GetCache() Cache {
+	return cache
+}
+
+// replaces the cache chosen by CACHE_DRIVER, e.g. with a memory cache in tests
+func SetCache(c Cache) {
+	cache = c
+}
+
+func GetCacheDriver() string {
+	driver := strings.ToLower(os.Getenv("CACHE_DRIVER"))
+	if driver == "" {
+		return CacheDriverRedis
+	}
+	return driver
+}
+
+func tagKey(tag string) string {
+	return "Tag:" + tag
+}
+
+// max number of keys kept by the memory cache
+func getCacheMaxEntries() int {
+	maxEntries, err := strconv.Atoi(os.Getenv("CACHE_MAX_ENTRIES"))
+	if err != nil || maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return maxEntries
+}
+
+// unavailable errors are already logged by the backend
+func ignoreCacheUnavailable(err error) error {
+	if errors.Is(err, ErrCacheUnavailable) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bsm/redislock"
+)
+
+// distributed lock on a cache key so one process rebuilds it,
+// without redis it's always obtained and callers only coordinate locally
+func ObtainCacheLock(ctx context.Context, key string, ttl time.Duration) (release func(), obtained bool) {
+	release = func() {}
+	if locker == nil || redisCache == nil || !redisCache.available(ctx) {
+		return release, true
+	}
+	lock, err := locker.Obtain(ctx, "Lock:"+key, ttl, nil)
+	if errors.Is(err, redislock.ErrNotObtained) {
+		return release, false
+	}
+	if err != nil {
+		redisCache.fail(err)
+		return release, true
+	}
+	return func() {
+		lock.Release(context.WithoutCancel(ctx))
+	}, true
+}
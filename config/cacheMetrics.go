@@ -0,0 +1,41 @@
+package config
+
+import (
+	"expvar"
+)
+
+// cache counters, published at /debug/vars under "cache"
+var (
+	cacheMetrics = expvar.NewMap("cache")
+
+	l1Hits   = new(expvar.Int)
+	l1Misses = new(expvar.Int)
+	l2Hits   = new(expvar.Int)
+	l2Misses = new(expvar.Int)
+	l2Errors = new(expvar.Int)
+
+	invalidationsPublished = new(expvar.Int)
+	invalidationsReceived  = new(expvar.Int)
+)
+
+func hitRatio(hits *expvar.Int, misses *expvar.Int) expvar.Func {
+	return func() any {
+		total := hits.Value() + misses.Value()
+		if total == 0 {
+			return 0.0
+		}
+		return float64(hits.Value()) / float64(total)
+	}
+}
+
+func init() {
+	cacheMetrics.Set("l1_hits", l1Hits)
+	cacheMetrics.Set("l1_misses", l1Misses)
+	cacheMetrics.Set("l1_hit_ratio", hitRatio(l1Hits, l1Misses))
+	cacheMetrics.Set("l2_hits", l2Hits)
+	cacheMetrics.Set("l2_misses", l2Misses)
+	cacheMetrics.Set("l2_errors", l2Errors)
+	cacheMetrics.Set("l2_hit_ratio", hitRatio(l2Hits, l2Misses))
+	cacheMetrics.Set("invalidations_published", invalidationsPublished)
+	cacheMetrics.Set("invalidations_received", invalidationsReceived)
+}
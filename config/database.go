@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -17,17 +18,25 @@ import (
 const SearchLimit = 10
 
 var (
-	db *gorm.DB
+	db     *gorm.DB
+	dbOnce sync.Once
 )
 
+// connects on first use, so packages can be loaded, e.g. by tests, without a database
 func GetDB() *gorm.DB {
+	dbOnce.Do(connectDatabase)
 	return db
 }
 
+// replaces the database, e.g. with a dry run one in tests
+func SetDB(d *gorm.DB) {
+	dbOnce.Do(func() {})
+	db = d
+}
+
 func init() {
 	// Load env from .env
 	godotenv.Load()
-	connectDatabase()
 }
 
 func connectDatabase() {
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// in-process LRU cache with per key expiry, not shared between instances
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	// most recently used in front
+	order *list.List
+	tags  map[string]*memoryCacheTag
+}
+
+type memoryCacheTag struct {
+	keys map[string]struct{}
+	// zero when kept until deleted
+	expiresAt time.Time
+}
+
+type memoryCacheEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+func (entry *memoryCacheEntry) expired(now time.Time) bool {
+	return !entry.expiresAt.IsZero() && !now.Before(entry.expiresAt)
+}
+
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		tags:       make(map[string]*memoryCacheTag),
+	}
+}
+
+// live entry of key, expired ones are removed
+func (c *MemoryCache) get(key string) (*memoryCacheEntry, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	if entry.expired(time.Now()) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry, true
+}
+
+func (c *MemoryCache) set(key string, value string, expiresAt time.Time) {
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*memoryCacheEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&memoryCacheEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.get(key)
+	if !ok {
+		l1Misses.Add(1)
+		return "", false, nil
+	}
+	l1Hits.Add(1)
+	return entry.value, true, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value string, exp time.Duration) error {
+	var expiresAt time.Time
+	if exp > 0 {
+		expiresAt = time.Now().Add(exp)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, value, expiresAt)
+	return nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+	return nil
+}
+
+// keeps the expiry of an existing key, same as redis INCR
+func (c *MemoryCache) Incr(ctx context.Context, key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var value int64
+	var expiresAt time.Time
+	if entry, ok := c.get(key); ok {
+		var err error
+		if value, err = strconv.ParseInt(entry.value, 10, 64); err != nil {
+			return 0, errors.New("value is not an integer")
+		}
+		expiresAt = entry.expiresAt
+	}
+	value++
+	c.set(key, strconv.FormatInt(value, 10), expiresAt)
+	return value, nil
+}
+
+func (c *MemoryCache) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.tags = make(map[string]*memoryCacheTag)
+	return nil
+}
+
+// tag expiry is only ever extended so it outlives every key
+func (c *MemoryCache) Tag(ctx context.Context, tag string, exp time.Duration, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	entry, ok := c.tags[tag]
+	if !ok || (!entry.expiresAt.IsZero() && !now.Before(entry.expiresAt)) {
+		if len(c.tags) >= c.maxEntries {
+			c.pruneTags(now)
+		}
+		entry = &memoryCacheTag{keys: make(map[string]struct{}), expiresAt: now.Add(exp)}
+		c.tags[tag] = entry
+	}
+	if exp <= 0 {
+		entry.expiresAt = time.Time{}
+	} else if !entry.expiresAt.IsZero() && entry.expiresAt.Before(now.Add(exp)) {
+		entry.expiresAt = now.Add(exp)
+	}
+	for _, key := range keys {
+		entry.keys[key] = struct{}{}
+	}
+	return nil
+}
+
+// drop expired tags & tags whose keys are all gone
+func (c *MemoryCache) pruneTags(now time.Time) {
+	for tag, entry := range c.tags {
+		if !entry.expiresAt.IsZero() && !now.Before(entry.expiresAt) {
+			delete(c.tags, tag)
+			continue
+		}
+		for key := range entry.keys {
+			if _, ok := c.entries[key]; !ok {
+				delete(entry.keys, key)
+			}
+		}
+		if len(entry.keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+func (c *MemoryCache) DeleteTags(ctx context.Context, tags ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tag := range tags {
+		entry, ok := c.tags[tag]
+		if !ok {
+			continue
+		}
+		for key := range entry.keys {
+			if element, ok := c.entries[key]; ok {
+				c.order.Remove(element)
+				delete(c.entries, key)
+			}
+		}
+		delete(c.tags, tag)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// how long redis is skipped after a failure before trying again
+const redisRetryInterval = 5 * time.Second
+
+// max failed deletes kept for retry, beyond it the db is flushed once redis is back
+const redisMaxPendingDeletes = 10000
+
+// redis backed cache, while redis is down every call returns ErrCacheUnavailable
+// so requests are served from the database instead of waiting on timeouts
+type RedisCache struct {
+	client *redis.Client
+
+	mu        sync.Mutex
+	downUntil time.Time
+	// deletes that failed while down, applied before anything is read again
+	pendingDeletes map[string]struct{}
+	pendingTags    map[string]struct{}
+	flushPending   bool
+}
+
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{
+		client:         client,
+		pendingDeletes: make(map[string]struct{}),
+		pendingTags:    make(map[string]struct{}),
+	}
+}
+
+func (c *RedisCache) markDown(err error) {
+	if c.downUntil.IsZero() {
+		logg.WithField("error", err.Error()).Error("redis unavailable, serving from database")
+	}
+	c.downUntil = time.Now().Add(redisRetryInterval)
+}
+
+// whether redis can be used, replaying failed deletes once it's back
+// so nothing invalidated during the outage is served stale
+func (c *RedisCache) available(ctx context.Context) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.downUntil.IsZero() && time.Now().Before(c.downUntil) {
+		return false
+	}
+	if err := c.replayPending(ctx); err != nil {
+		c.markDown(err)
+		return false
+	}
+	c.downUntil = time.Time{}
+	return true
+}
+
+func (c *RedisCache) replayPending(ctx context.Context) error {
+	if c.flushPending {
+		if err := c.client.FlushDB(ctx).Err(); err != nil {
+			return err
+		}
+		c.flushPending = false
+		clear(c.pendingDeletes)
+		clear(c.pendingTags)
+		return nil
+	}
+	if len(c.pendingTags) > 0 {
+		tags := make([]string, 0, len(c.pendingTags))
+		for tag := range c.pendingTags {
+			tags = append(tags, tag)
+		}
+		if err := deleteTagsScript.Run(ctx, c.client, tagKeys(tags)).Err(); err != nil {
+			return err
+		}
+		clear(c.pendingTags)
+	}
+	if len(c.pendingDeletes) > 0 {
+		keys := make([]string, 0, len(c.pendingDeletes))
+		for key := range c.pendingDeletes {
+			keys = append(keys, key)
+		}
+		if err := c.client.Del(ctx, keys...).Err(); err != nil {
+			return err
+		}
+		clear(c.pendingDeletes)
+	}
+	return nil
+}
+
+// redis errors other than a missing key mean it's down
+func (c *RedisCache) fail(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	l2Errors.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.markDown(err)
+	return ErrCacheUnavailable
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (string, bool, error) {
+	if !c.available(ctx) {
+		return "", false, ErrCacheUnavailable
+	}
+	val, err := c.client.Get(ctx, key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			l2Misses.Add(1)
+			return "", false, nil
+		}
+		return "", false, c.fail(err)
+	}
+	l2Hits.Add(1)
+	return val, true, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value string, exp time.Duration) error {
+	if !c.available(ctx) {
+		return ErrCacheUnavailable
+	}
+	if err := c.client.Set(ctx, key, value, exp).Err(); err != nil {
+		return c.fail(err)
+	}
+	return nil
+}
+
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if c.available(ctx) {
+		err := c.client.Del(ctx, keys...).Err()
+		if err == nil {
+			return nil
+		}
+		if err = c.fail(err); !errors.Is(err, ErrCacheUnavailable) {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		c.pendingDeletes[key] = struct{}{}
+	}
+	c.checkPendingLimit()
+	return ErrCacheUnavailable
+}
+
+func (c *RedisCache) checkPendingLimit() {
+	if len(c.pendingDeletes)+len(c.pendingTags) > redisMaxPendingDeletes {
+		c.flushPending = true
+		clear(c.pendingDeletes)
+		clear(c.pendingTags)
+	}
+}
+
+func (c *RedisCache) Incr(ctx context.Context, key string) (int64, error) {
+	if !c.available(ctx) {
+		return 0, ErrCacheUnavailable
+	}
+	value, err := c.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, c.fail(err)
+	}
+	return value, nil
+}
+
+func (c *RedisCache) Flush(ctx context.Context) error {
+	if !c.available(ctx) {
+		c.mu.Lock()
+		c.flushPending = true
+		c.mu.Unlock()
+		return ErrCacheUnavailable
+	}
+	if err := c.client.FlushDB(ctx).Err(); err != nil {
+		return c.fail(err)
+	}
+	return nil
+}
+
+func (c *RedisCache) Publish(ctx context.Context, channel string, message string) error {
+	if !c.available(ctx) {
+		return ErrCacheUnavailable
+	}
+	if err := c.client.Publish(ctx, channel, message).Err(); err != nil {
+		return c.fail(err)
+	}
+	return nil
+}
+
+// adds members to the tag set, its expiry is only ever extended
+// so it outlives every member, 0 keeps it until deleted
+var tagScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('SADD', KEYS[1], unpack(ARGV, 2))
+local exp = tonumber(ARGV[1])
+if exp == 0 then
+	redis.call('PERSIST', KEYS[1])
+elseif existed == 0 then
+	redis.call('PEXPIRE', KEYS[1], exp)
+else
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl >= 0 and ttl < exp then
+		redis.call('PEXPIRE', KEYS[1], exp)
+	end
+end
+return 1
+`)
+
+// removes members of the tag sets & the sets, returning the removed members
+var deleteTagsScript = redis.NewScript(`
+local removed = {}
+for _, tag in ipairs(KEYS) do
+	local members = redis.call('SMEMBERS', tag)
+	for _, member in ipairs(members) do
+		redis.call('DEL', member)
+		table.insert(removed, member)
+	end
+	redis.call('DEL', tag)
+end
+return removed
+`)
+
+func tagKeys(tags []string) []string {
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, tagKey(tag))
+	}
+	return keys
+}
+
+func (c *RedisCache) Tag(ctx context.Context, tag string, exp time.Duration, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if !c.available(ctx) {
+		return ErrCacheUnavailable
+	}
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, exp.Milliseconds())
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	if err := tagScript.Run(ctx, c.client, []string{tagKey(tag)}, args...).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		return c.fail(err)
+	}
+	return nil
+}
+
+// removed keys, so other tiers can evict them too
+func (c *RedisCache) deleteTags(ctx context.Context, tags ...string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	if c.available(ctx) {
+		removed, err := deleteTagsScript.Run(ctx, c.client, tagKeys(tags)).StringSlice()
+		if err == nil {
+			return removed, nil
+		}
+		if err = c.fail(err); !errors.Is(err, ErrCacheUnavailable) {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tag := range tags {
+		c.pendingTags[tag] = struct{}{}
+	}
+	c.checkPendingLimit()
+	return nil, ErrCacheUnavailable
+}
+
+func (c *RedisCache) DeleteTags(ctx context.Context, tags ...string) error {
+	_, err := c.deleteTags(ctx, tags...)
+	return err
+}
@@ -12,15 +12,18 @@ import (
 )
 
 var (
-	rdb    *redis.Client
-	locker *redislock.Client
+	rdb        *redis.Client
+	locker     *redislock.Client
+	redisCache *RedisCache
 )
 var ctx = context.Background()
 
+// nil when CACHE_DRIVER is memory
 func GetRedisDB() *redis.Client {
 	return rdb
 }
 
+// nil when CACHE_DRIVER is memory
 func GetRedisLock() *redislock.Client {
 	return locker
 }
@@ -31,12 +34,9 @@ func GetRedisContext() context.Context {
 
 func GetRedisObject(key string, dest interface{}) (bool, error) {
 	// fmt.Printf("	(Redis) Getting object of `%s`\n", key)
-	val, err := rdb.Get(ctx, key).Result()
-	if err != nil {
-		if err.Error() == "redis: nil" {
-			return false, nil
-		}
-		return false, err
+	val, exists, err := cache.Get(ctx, key)
+	if err != nil || !exists {
+		return false, ignoreCacheUnavailable(err)
 	}
 	err = json.Unmarshal([]byte(val), &dest)
 	if err != nil {
@@ -47,14 +47,11 @@ func GetRedisObject(key string, dest interface{}) (bool, error) {
 
 func GetRedisValue(key string) (string, bool, error) {
 	// fmt.Printf("	(Redis) Getting value of `%s`\n", key)
-	val, err := rdb.Get(ctx, key).Result()
+	val, exists, err := cache.Get(ctx, key)
 	if err != nil {
-		if err.Error() == "redis: nil" {
-			return "", false, nil
-		}
-		return "", false, err
+		return "", false, ignoreCacheUnavailable(err)
 	}
-	return val, true, nil
+	return val, exists, nil
 }
 
 func SetRedisObject(key string, obj interface{}, exp time.Duration) error {
@@ -63,78 +60,71 @@ func SetRedisObject(key string, obj interface{}, exp time.Duration) error {
 	if err != nil {
 		return err
 	}
-	if err = rdb.Set(ctx, key, objInByte, exp).Err(); err != nil {
-		return err
-	}
-	return nil
-}
-
-// store key in a set for faster adding & retrieving
-func AddRedisSet(setKey string, member string) error {
-	if err := rdb.SAdd(ctx, setKey, member).Err(); err != nil {
-		return err
-	}
-	return nil
-}
-
-func GetRedisSetMembers(setKey string) ([]string, error) {
-	return rdb.SMembers(ctx, setKey).Result()
-}
-
-func RemoveRedisSetMember(setKey string, member string) error {
-	return rdb.SRem(ctx, setKey, member).Err()
+	return ignoreCacheUnavailable(cache.Set(ctx, key, string(objInByte), exp))
 }
 
 func SetRedisValue(key string, value string, exp time.Duration) error {
 	// fmt.Printf("	(Redis) Setting value `%s`:%s\n", key, value)
-	// rdb.Set
-	return rdb.Set(ctx, key, value, exp).Err()
+	return ignoreCacheUnavailable(cache.Set(ctx, key, value, exp))
 }
 
+// keys that failed to be removed while redis is down are removed once it's back
 func RemoveRedisKey(keys ...string) error {
 	// fmt.Printf("	(Redis) Removing `%v`\n", keys)
-	_, err := rdb.Del(ctx, keys...).Result()
-	return err
+	return ignoreCacheUnavailable(cache.Delete(ctx, keys...))
+}
+
+// tag key so RemoveRedisTags of any of tags removes it, exp should be the key's
+func TagRedisKey(key string, exp time.Duration, tags ...string) error {
+	for _, tag := range tags {
+		if err := cache.Tag(ctx, tag, exp, key); err != nil {
+			return ignoreCacheUnavailable(err)
+		}
+	}
+	return nil
+}
+
+// remove every key tagged with tags
+func RemoveRedisTags(tags ...string) error {
+	return ignoreCacheUnavailable(cache.DeleteTags(ctx, tags...))
 }
 
 func ClearRedis(ctx context.Context) error {
-	cmd := rdb.FlushAll(ctx)
-	return cmd.Err()
+	return ignoreCacheUnavailable(cache.Flush(ctx))
 }
 
 // add one and returns it, while storing the updated value
 func GetRedisCounter(ctx context.Context, key string) (int64, error) {
-	// exists, err := GetRedisObject(key, &value)
-	// if err != nil {
-	// 	return 0, err
-	// }
-	// if !exists {
-	// 	// TODO: get from database
-	// 	return 0, nil
-	// }
-	// result, err := rdb.Incr(ctx, key).Result()
-	// if err != nil {
-	// 	return 0, err
-	// }
-
-	return rdb.Incr(ctx, key).Result()
+	return cache.Incr(ctx, key)
 }
 
 func init() {
 	// Load env from .env
 	godotenv.Load()
-	connectRedis()
+	if GetCacheDriver() == CacheDriverMemory {
+		cache = NewMemoryCache(getCacheMaxEntries())
+		return
+	}
+	redisCache = NewRedisCache(connectRedis())
+	// unreachable redis is not fatal, the cache is skipped until it's back
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		redisCache.fail(err)
+	}
 	locker = redislock.New(rdb)
+	cache = redisCache
+	if l1Ttl := getCacheL1Lifespan(); l1Ttl > 0 {
+		tieredCache := NewTieredCache(redisCache, rdb, getCacheMaxEntries(), l1Ttl)
+		go tieredCache.Subscribe(ctx)
+		cache = tieredCache
+	}
 }
 
-func connectRedis() {
+func connectRedis() *redis.Client {
 	rdb = redis.NewClient(&redis.Options{
 		Addr:     os.Getenv("REDIS_ADDRESS"),
 		Password: "",
 		DB:       1, // use default DB
 		PoolSize: 100,
 	})
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		panic("Fail to Connect Redis")
-	}
+	return rdb
 }
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/redis/go-redis/v9"
+)
+
+// an index is locked by the process that opened it, others give up after this
+const searchIndexLockTimeout = "1s"
+
+// every replica keeps its own index, changes & rebuilds are broadcast on this channel
+const searchIndexChannel = "search:index"
+
+var ErrSearchIndexInUse = errors.New("search index is used by another process")
+
+var (
+	searchIndexesMu sync.Mutex
+	// opened on first use & kept open for the life of the process
+	searchIndexes = make(map[string]bleve.Index)
+	// one rebuild at a time, they share the directory the new index is built in
+	searchRebuildMu sync.Mutex
+	// ignores our own messages
+	searchIndexOrigin = newSearchIndexOrigin()
+)
+
+// documents of an index to sync from the database, or the whole index to rebuild
+type SearchIndexMessage struct {
+	Origin  string   `json:"origin"`
+	Index   string   `json:"index"`
+	Ids     []string `json:"ids,omitempty"`
+	Rebuild bool     `json:"rebuild,omitempty"`
+}
+
+func newSearchIndexOrigin() string {
+	origin := make([]byte, 8)
+	rand.Read(origin)
+	return hex.EncodeToString(origin)
+}
+
+// directory of the index files, SEARCH_INDEX_PATH or ./search
+func getSearchIndexPath(name string) string {
+	dir := os.Getenv("SEARCH_INDEX_PATH")
+	if dir == "" {
+		dir = "search"
+	}
+	return filepath.Join(dir, name+".bleve")
+}
+
+func openSearchIndex(name string) (bleve.Index, error) {
+	index, err := bleve.OpenUsing(getSearchIndexPath(name), map[string]interface{}{
+		"bolt_timeout": searchIndexLockTimeout,
+	})
+	if err != nil && !errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		return nil, fmt.Errorf("%w: %s, %v", ErrSearchIndexInUse, name, err)
+	}
+	return index, err
+}
+
+func createSearchIndex(name string, indexMapping mapping.IndexMapping) (bleve.Index, error) {
+	path := getSearchIndexPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return bleve.NewUsing(path, indexMapping, bleve.Config.DefaultIndexType, bleve.Config.DefaultKVStore, map[string]interface{}{
+		"bolt_timeout": searchIndexLockTimeout,
+	})
+}
+
+// index name, created empty with indexMapping when it doesn't exist yet
+func GetSearchIndex(name string, indexMapping func() mapping.IndexMapping) (bleve.Index, error) {
+	searchIndexesMu.Lock()
+	defer searchIndexesMu.Unlock()
+	if index, ok := searchIndexes[name]; ok {
+		return index, nil
+	}
+
+	index, err := openSearchIndex(name)
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		logg.WithField("index", name).Warn("search index created empty, run search:reindex to fill it")
+		index, err = createSearchIndex(name, indexMapping())
+	}
+	if err != nil {
+		return nil, err
+	}
+	searchIndexes[name] = index
+	return index, nil
+}
+
+// builds a new index name with indexMapping & fill next to the one in use, then swaps it in
+// searches keep using the old index meanwhile, fails while another process has it open
+func RebuildSearchIndex(name string, indexMapping func() mapping.IndexMapping, fill func(bleve.Index) error) error {
+	searchRebuildMu.Lock()
+	defer searchRebuildMu.Unlock()
+
+	path := getSearchIndexPath(name)
+	rebuildPath := path + ".rebuild"
+	if err := os.RemoveAll(rebuildPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	rebuilt, err := bleve.NewUsing(rebuildPath, indexMapping(), bleve.Config.DefaultIndexType, bleve.Config.DefaultKVStore, map[string]interface{}{
+		"bolt_timeout": searchIndexLockTimeout,
+	})
+	if err != nil {
+		return err
+	}
+	if err := fill(rebuilt); err != nil {
+		rebuilt.Close()
+		os.RemoveAll(rebuildPath)
+		return err
+	}
+	if err := rebuilt.Close(); err != nil {
+		return err
+	}
+
+	searchIndexesMu.Lock()
+	defer searchIndexesMu.Unlock()
+
+	index, ok := searchIndexes[name]
+	if !ok {
+		// not ours, make sure no other process is using it before it's removed
+		index, err = openSearchIndex(name)
+		if err != nil && !errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+			return err
+		}
+		ok = err == nil
+	}
+	if ok {
+		index.Close()
+		delete(searchIndexes, name)
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	if err := os.Rename(rebuildPath, path); err != nil {
+		return err
+	}
+	if index, err = openSearchIndex(name); err != nil {
+		return err
+	}
+	searchIndexes[name] = index
+	return nil
+}
+
+// tells the other replicas to sync ids of index name, or to rebuild it
+// a no-op with the memory cache driver, which runs a single process
+func PublishSearchIndex(ctx context.Context, message SearchIndexMessage) error {
+	if redisCache == nil {
+		return nil
+	}
+	message.Origin = searchIndexOrigin
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return redisCache.Publish(ctx, searchIndexChannel, string(payload))
+}
+
+// calls handle on other processes' messages about index name, blocks for the life of the process
+// messages may have been missed before every (re)subscribe, so handle is asked to rebuild then
+func SubscribeSearchIndex(ctx context.Context, name string, handle func(SearchIndexMessage)) {
+	if rdb == nil {
+		return
+	}
+	pubsub := rdb.Subscribe(ctx, searchIndexChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.ChannelWithSubscriptions() {
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			if msg.Kind == "subscribe" {
+				handle(SearchIndexMessage{Index: name, Rebuild: true})
+			}
+		case *redis.Message:
+			var message SearchIndexMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil || message.Origin == searchIndexOrigin || message.Index != name {
+				continue
+			}
+			handle(message)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+)
+
+func testIndexMapping() mapping.IndexMapping {
+	return bleve.NewIndexMapping()
+}
+
+func searchIndexIds(t *testing.T, name string) map[string]bool {
+	t.Helper()
+	index, err := GetSearchIndex(name, testIndexMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := index.Search(bleve.NewSearchRequest(bleve.NewMatchAllQuery()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]bool)
+	for _, hit := range result.Hits {
+		ids[hit.ID] = true
+	}
+	return ids
+}
+
+func TestRebuildSearchIndex(t *testing.T) {
+	tests := []struct {
+		name string
+		// documents of the index before the rebuild, nil if it doesn't exist
+		before []string
+		fill   []string
+		// fill fails, the index in use is kept
+		fillErr error
+		want    []string
+	}{
+		{name: "swaps in the rebuilt index", before: []string{"1", "2"}, fill: []string{"2", "3"}, want: []string{"2", "3"}},
+		{name: "creates a missing index", fill: []string{"1"}, want: []string{"1"}},
+		{name: "keeps the index when fill fails", before: []string{"1"}, fill: []string{"2"}, fillErr: errors.New("database is down"), want: []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SEARCH_INDEX_PATH", t.TempDir())
+			name := "test"
+			t.Cleanup(func() {
+				searchIndexesMu.Lock()
+				if index, ok := searchIndexes[name]; ok {
+					index.Close()
+					delete(searchIndexes, name)
+				}
+				searchIndexesMu.Unlock()
+			})
+
+			if tt.before != nil {
+				index, err := GetSearchIndex(name, testIndexMapping)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, id := range tt.before {
+					if err := index.Index(id, map[string]string{"name": "before " + id}); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			err := RebuildSearchIndex(name, testIndexMapping, func(index bleve.Index) error {
+				for _, id := range tt.fill {
+					if err := index.Index(id, map[string]string{"name": "rebuilt " + id}); err != nil {
+						return err
+					}
+				}
+				return tt.fillErr
+			})
+			if !errors.Is(err, tt.fillErr) {
+				t.Fatalf("RebuildSearchIndex() error = %v, want %v", err, tt.fillErr)
+			}
+
+			got := searchIndexIds(t, name)
+			if len(got) != len(tt.want) {
+				t.Fatalf("index has %v, want %v", got, tt.want)
+			}
+			for _, id := range tt.want {
+				if !got[id] {
+					t.Errorf("index has %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// every replica evicts its L1 on messages of this channel
+const cacheInvalidationChannel = "cache:invalidate"
+
+// keys evicted by a replica, Flush evicts everything
+type cacheInvalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys,omitempty"`
+	Flush  bool     `json:"flush,omitempty"`
+}
+
+// per-process L1 in front of redis, deletes are broadcast so other replicas
+// evict their copy, L1 entries expire after l1Ttl at the latest
+type TieredCache struct {
+	l1     *MemoryCache
+	l2     *RedisCache
+	l1Ttl  time.Duration
+	client *redis.Client
+	// ignores our own invalidations
+	origin string
+}
+
+func NewTieredCache(l2 *RedisCache, client *redis.Client, maxEntries int, l1Ttl time.Duration) *TieredCache {
+	origin := make([]byte, 8)
+	rand.Read(origin)
+	return &TieredCache{
+		l1:     NewMemoryCache(maxEntries),
+		l2:     l2,
+		l1Ttl:  l1Ttl,
+		client: client,
+		origin: hex.EncodeToString(origin),
+	}
+}
+
+// how long a replica may serve a value from L1, 0 disables L1
+func getCacheL1Lifespan() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("CACHE_L1_SECONDS"))
+	if err != nil || seconds < 0 {
+		seconds = 30
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func (c *TieredCache) l1Exp(exp time.Duration) time.Duration {
+	if exp > 0 && exp < c.l1Ttl {
+		return exp
+	}
+	return c.l1Ttl
+}
+
+func (c *TieredCache) publish(ctx context.Context, invalidation cacheInvalidation) {
+	invalidation.Origin = c.origin
+	payload, err := json.Marshal(invalidation)
+	if err != nil {
+		return
+	}
+	// while redis is down others can't read the new value either, their L1 expires on its own
+	if err := c.l2.Publish(ctx, cacheInvalidationChannel, string(payload)); err == nil {
+		invalidationsPublished.Add(1)
+	}
+}
+
+// evicts L1 on other replicas' invalidations, blocks for the life of the process
+// L1 is cleared on every resubscribe since messages may have been missed meanwhile
+func (c *TieredCache) Subscribe(ctx context.Context) {
+	pubsub := c.client.Subscribe(ctx, cacheInvalidationChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.ChannelWithSubscriptions() {
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			if msg.Kind == "subscribe" {
+				c.l1.Flush(ctx)
+			}
+		case *redis.Message:
+			var invalidation cacheInvalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &invalidation); err != nil || invalidation.Origin == c.origin {
+				continue
+			}
+			invalidationsReceived.Add(1)
+			if invalidation.Flush {
+				c.l1.Flush(ctx)
+			} else {
+				c.l1.Delete(ctx, invalidation.Keys...)
+			}
+		}
+	}
+}
+
+func (c *TieredCache) Get(ctx context.Context, key string) (string, bool, error) {
+	if val, exists, _ := c.l1.Get(ctx, key); exists {
+		return val, true, nil
+	}
+	val, exists, err := c.l2.Get(ctx, key)
+	if err != nil || !exists {
+		return "", false, err
+	}
+	c.l1.Set(ctx, key, val, c.l1Ttl)
+	return val, true, nil
+}
+
+func (c *TieredCache) Set(ctx context.Context, key string, value string, exp time.Duration) error {
+	if err := c.l2.Set(ctx, key, value, exp); err != nil {
+		c.l1.Delete(ctx, key)
+		return err
+	}
+	// fills of missing keys, other replicas can't hold them in L1, invalidations are published by Delete & co
+	c.l1.Set(ctx, key, value, c.l1Exp(exp))
+	return nil
+}
+
+func (c *TieredCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	c.l1.Delete(ctx, keys...)
+	err := c.l2.Delete(ctx, keys...)
+	c.publish(ctx, cacheInvalidation{Keys: keys})
+	return err
+}
+
+// counters are not kept in L1
+func (c *TieredCache) Incr(ctx context.Context, key string) (int64, error) {
+	c.l1.Delete(ctx, key)
+	value, err := c.l2.Incr(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	c.publish(ctx, cacheInvalidation{Keys: []string{key}})
+	return value, nil
+}
+
+func (c *TieredCache) Flush(ctx context.Context) error {
+	c.l1.Flush(ctx)
+	err := c.l2.Flush(ctx)
+	c.publish(ctx, cacheInvalidation{Flush: true})
+	return err
+}
+
+// tags are kept by redis only
+func (c *TieredCache) Tag(ctx context.Context, tag string, exp time.Duration, keys ...string) error {
+	return c.l2.Tag(ctx, tag, exp, keys...)
+}
+
+func (c *TieredCache) DeleteTags(ctx context.Context, tags ...string) error {
+	keys, err := c.l2.deleteTags(ctx, tags...)
+	if err != nil {
+		// tags are only known to redis, so nothing in L1 can be trusted
+		c.l1.Flush(ctx)
+		return err
+	}
+	if len(keys) > 0 {
+		c.l1.Delete(ctx, keys...)
+		c.publish(ctx, cacheInvalidation{Keys: keys})
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package directives
+
+import (
+	"context"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// audit every mutation & every operation under impersonation,
+// entity changes are recorded by gorm callbacks in their transaction
+func AuditOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+
+	oc := graphql.GetOperationContext(ctx)
+	if oc.Operation == nil {
+		return next(ctx)
+	}
+	_, impersonated := utils.GetImpersonatorIdFromContext(ctx)
+	if oc.Operation.Operation != ast.Mutation && !impersonated {
+		return next(ctx)
+	}
+
+	name := oc.OperationName
+	if name == "" {
+		fields := make([]string, 0, len(oc.Operation.SelectionSet))
+		for _, selection := range oc.Operation.SelectionSet {
+			if field, ok := selection.(*ast.Field); ok {
+				fields = append(fields, field.Name)
+			}
+		}
+		name = strings.Join(fields, ",")
+	}
+
+	ctx = models.WithAuditOperation(ctx, name, oc.Variables)
+	handler := next(ctx)
+	return func(ctx context.Context) *graphql.Response {
+		response := handler(ctx)
+		if err := models.WriteAuditOperation(ctx); err != nil {
+			graphql.AddErrorf(ctx, "cannot write audit log: %s", err.Error())
+		}
+		return response
+	}
+}
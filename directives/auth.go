@@ -3,89 +3,112 @@ package directives
 import (
 	"context"
 	"errors"
-	"fmt"
 
 	"github.com/99designs/gqlgen/graphql"
-	"github.com/aungmyozaw92/go-graphql/config"
 	"github.com/aungmyozaw92/go-graphql/middlewares"
 	"github.com/aungmyozaw92/go-graphql/models"
 	"github.com/aungmyozaw92/go-graphql/utils"
 	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
+// only requires an authenticated user or api key
 func Auth(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
-	
+
+	ctx, _, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return next(ctx)
+}
+
+// requires the caller's role to allow action on module
+func HasPermission(ctx context.Context, obj interface{}, next graphql.Resolver, module string, action string) (interface{}, error) {
+
+	ctx, roleIds, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeUser(ctx, roleIds, module, action); err != nil {
+		return nil, &gqlerror.Error{
+			Message: err.Error(),
+		}
+	}
+
+	return next(ctx)
+}
+
+// resolve caller's active roles from api key or token
+func authenticate(ctx context.Context) (context.Context, []int, error) {
+
+	// api keys are authorised by their role, same as users
+	if apiKey := middlewares.ApiKeyValue(ctx); apiKey != nil {
+		return ctx, []int{apiKey.RoleId}, nil
+	}
+
 	tokenData := middlewares.CtxValue(ctx)
-	// fmt.Println("tokenData", tokenData)
 	if tokenData == nil {
-		return nil, &gqlerror.Error{
+		return ctx, nil, &gqlerror.Error{
 			Message: "Access Denied",
 		}
 	}
 
 	userId, ok := utils.GetUserIdFromContext(ctx)
 	if !ok || userId == 0 {
-		return nil, &gqlerror.Error{
+		return ctx, nil, &gqlerror.Error{
 			Message: "Access Denied",
 		}
 	}
 
 	user, err := models.GetUser(ctx, userId)
 	if err != nil {
-		return nil, &gqlerror.Error{
+		return ctx, nil, &gqlerror.Error{
 			Message: err.Error(),
 		}
 	}
 	if !*user.IsActive {
-		return nil, &gqlerror.Error{
+		return ctx, nil, &gqlerror.Error{
 			Message: "User is disabled",
 		}
 	}
 
-	gqlpath := graphql.GetPath(ctx).String()
-	
-	// user is either owner or custom
-	if err := authorizeUser(ctx, user.RoleId, gqlpath); err != nil {
-		return nil, &gqlerror.Error{
+	// tokens issued before a role, grant or permission change are rejected
+	permissionVersion, err := models.GetUserPermissionVersion(ctx, user)
+	if err != nil {
+		return ctx, nil, &gqlerror.Error{
 			Message: err.Error(),
 		}
 	}
-	
-	ctx = context.WithValue(ctx, utils.ContextKeyUsername, user.Username)
-
-	return next(ctx)
-}
+	if tokenData.RoleId != user.RoleId || tokenData.PermissionVersion != permissionVersion {
+		return ctx, nil, &gqlerror.Error{
+			Message: "Permission has changed, please login again",
+		}
+	}
 
-// retrieve role's allowed query paths from redis and check if the gqlpath is allowed
-func authorizeUser(ctx context.Context, roleId int, gqlpath string) error {
-	
-	var queryPaths map[string]bool
-	exists, err := config.GetRedisObject("AllowedPaths:Role:"+fmt.Sprint(roleId), &queryPaths)
+	// grants are checked against the current time, so expiries apply without re-login
+	roleIds, err := models.GetActiveRoleIds(ctx, user)
 	if err != nil {
-		return err
+		return ctx, nil, &gqlerror.Error{
+			Message: err.Error(),
+		}
 	}
 
-	if !exists {
+	ctx = context.WithValue(ctx, utils.ContextKeyUsername, user.Username)
 
-		queryPaths, err = models.GetQueryPathsFromRole(ctx, roleId)
-		if err != nil {
-			return err
-		}
+	return ctx, roleIds, nil
+}
 
-		// store in redis
-		if err := config.SetRedisObject("AllowedPaths:Role:"+fmt.Sprint(roleId), &queryPaths, 0); err != nil {
-			return err
-		}
+// retrieve roles' permissions from redis and check if module action is allowed by any of them
+func authorizeUser(ctx context.Context, roleIds []int, module string, action string) error {
+
+	permissions, err := models.GetPermissionsFromRoles(ctx, roleIds)
+	if err != nil {
+		return err
 	}
 
-	// check if current path is allowed for current user
 	// using a map for faster look up, non-existent key will return false, default zero for boolean
-	fmt.Println(queryPaths)
-	fmt.Println(gqlpath)
-	if allowed := queryPaths[gqlpath]; !allowed {
-	if gqlpath == "logout" {
-		return nil
-	}
+	if allowed := permissions[models.PermissionKey(module, action)]; !allowed {
 		return errors.New("permission not allow")
 	}
 
@@ -0,0 +1,78 @@
+package directives
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/aungmyozaw92/go-graphql/middlewares"
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+type fieldRulesString string
+
+const fieldRulesKey = fieldRulesString("fieldRules")
+
+// load the caller roles' field rules once per operation
+func FieldPermissionOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+
+	var roleIds []int
+	if apiKey := middlewares.ApiKeyValue(ctx); apiKey != nil {
+		roleIds = []int{apiKey.RoleId}
+	} else if tokenData := middlewares.CtxValue(ctx); tokenData != nil {
+		// grants are time bound, so the active roles are resolved per operation
+		var err error
+		roleIds, err = models.GetUserActiveRoleIds(ctx, tokenData.UserId)
+		if err != nil {
+			return graphql.OneShot(graphql.ErrorResponse(ctx, "cannot load field permissions: %s", err.Error()))
+		}
+	}
+	if len(roleIds) == 0 {
+		return next(ctx)
+	}
+
+	rules, err := models.GetFieldRulesFromRoles(ctx, roleIds)
+	if err != nil {
+		return graphql.OneShot(graphql.ErrorResponse(ctx, "cannot load field permissions: %s", err.Error()))
+	}
+	return next(context.WithValue(ctx, fieldRulesKey, rules))
+}
+
+// masked nullable fields resolve to null with an error, other hidden fields fail
+func FieldPermissionField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+
+	rules, _ := ctx.Value(fieldRulesKey).(map[string]models.FieldAccess)
+	if len(rules) == 0 {
+		return next(ctx)
+	}
+
+	fc := graphql.GetFieldContext(ctx)
+	field := models.FieldKey(fc.Object, fc.Field.Name)
+	access, ok := rules[field]
+	if !ok || access == models.FieldAccessVisible {
+		return next(ctx)
+	}
+
+	if access == models.FieldAccessMasked {
+		maskedErr := &gqlerror.Error{
+			Message: "field " + field + " is masked",
+			Extensions: map[string]interface{}{
+				"code":  "FIELD_MASKED",
+				"field": field,
+			},
+		}
+		if fc.Field.Definition.Type.NonNull {
+			return nil, maskedErr
+		}
+		graphql.AddError(ctx, maskedErr)
+		return nil, nil
+	}
+
+	return nil, &gqlerror.Error{
+		Message: "field " + field + " is denied",
+		Extensions: map[string]interface{}{
+			"code":  "FIELD_DENIED",
+			"field": field,
+		},
+	}
+}
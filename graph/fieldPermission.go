@@ -0,0 +1,25 @@
+package graph
+
+import (
+	"errors"
+
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// field rules must name an existing field of an object type in the schema
+func validateFieldPermissions(input []*models.NewFieldPermission) error {
+	for _, rule := range input {
+		def := parsedSchema.Types[rule.TypeName]
+		if def == nil || def.Kind != ast.Object || def.BuiltIn {
+			return errors.New("unknown type " + rule.TypeName)
+		}
+		if def.Fields.ForName(rule.FieldName) == nil {
+			return errors.New("unknown field " + models.FieldKey(rule.TypeName, rule.FieldName))
+		}
+		if def.Name == parsedSchema.Query.Name || (parsedSchema.Mutation != nil && def.Name == parsedSchema.Mutation.Name) {
+			return errors.New("use module permissions for " + def.Name + " fields")
+		}
+	}
+	return nil
+}
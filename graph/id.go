@@ -0,0 +1,102 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func MarshalID(id int) graphql.ContextMarshaler {
+	return graphql.ContextWriterFunc(func(ctx context.Context, w io.Writer) error {
+		graphql.MarshalInt(id).MarshalGQL(w)
+		return nil
+	})
+}
+
+// raw ids are still accepted next to global ones while clients move over
+// a global id must be of the type its argument or input field declares with @globalId
+func UnmarshalID(ctx context.Context, v interface{}) (int, error) {
+	str, ok := v.(string)
+	if !ok {
+		return graphql.UnmarshalInt(v)
+	}
+	if _, err := strconv.Atoi(str); err == nil {
+		return graphql.UnmarshalInt(v)
+	}
+
+	globalId, err := models.ParseGlobalID(str)
+	if err != nil {
+		return 0, err
+	}
+	expected := getGlobalIdType(ctx)
+	if expected == "" {
+		return 0, fmt.Errorf("%s takes a raw id", graphql.GetPath(ctx))
+	}
+	if !isGlobalIdOf(globalId, expected) {
+		return 0, fmt.Errorf("%s takes an id of %s, not %s", graphql.GetPath(ctx), expected, globalId.Type)
+	}
+	return globalId.ID, nil
+}
+
+func isGlobalIdOf(globalId models.GlobalID, typeName string) bool {
+	if globalId.Type == typeName {
+		return true
+	}
+	// an interface, e.g. Node, takes the ids of its types
+	def := parsedSchema.Types[typeName]
+	if def == nil || def.Kind != ast.Interface {
+		return false
+	}
+	return slices.ContainsFunc(parsedSchema.GetPossibleTypes(def), func(possible *ast.Definition) bool {
+		return possible.Name == globalId.Type
+	})
+}
+
+// type of @globalId on the argument or input field being unmarshalled, empty without one
+func getGlobalIdType(ctx context.Context) string {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || fc.Field.Definition == nil {
+		return ""
+	}
+
+	// argument first, then the input fields down to the id, list indexes are skipped
+	names := make([]string, 0)
+	for pc := graphql.GetPathContext(ctx); pc != nil; pc = pc.Parent {
+		if pc.Field != nil {
+			names = append(names, *pc.Field)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	slices.Reverse(names)
+
+	arg := fc.Field.Definition.Arguments.ForName(names[0])
+	if arg == nil {
+		return ""
+	}
+	directives, fieldType := arg.Directives, arg.Type
+	for _, name := range names[1:] {
+		def := parsedSchema.Types[fieldType.Name()]
+		if def == nil {
+			return ""
+		}
+		field := def.Fields.ForName(name)
+		if field == nil {
+			return ""
+		}
+		directives, fieldType = field.Directives, field.Type
+	}
+
+	directive := directives.ForName("globalId")
+	if directive == nil {
+		return ""
+	}
+	return directive.Arguments.ForName("type").Value.Raw
+}
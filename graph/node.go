@@ -0,0 +1,128 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/aungmyozaw92/go-graphql/middlewares"
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/graph-gophers/dataloader/v7"
+	"gorm.io/gorm"
+)
+
+// nodes(ids) refuses more ids than this
+const maxNodes = 100
+
+type nodeLoader func(ctx context.Context, id int) func() (models.Node, error)
+
+type nodeType struct {
+	// module whose read permission is needed, same as the type's get query
+	module string
+	load   nodeLoader
+}
+
+var nodeTypes = map[string]nodeType{
+	"User":     {module: "User", load: loadNode(func(l *middlewares.Loaders) *dataloader.Loader[int, *models.User] { return l.UserLoader })},
+	"Role":     {module: "Role", load: loadNode(func(l *middlewares.Loaders) *dataloader.Loader[int, *models.Role] { return l.RoleLoader })},
+	"Unit":     {module: "Unit", load: loadNode(func(l *middlewares.Loaders) *dataloader.Loader[int, *models.Unit] { return l.UnitLoader })},
+	"Category": {module: "Category", load: loadNode(func(l *middlewares.Loaders) *dataloader.Loader[int, *models.Category] { return l.CategoryLoader })},
+	"Product":  {module: "Product", load: loadNode(func(l *middlewares.Loaders) *dataloader.Loader[int, *models.Product] { return l.ProductLoader })},
+	"Image":    {module: "Product", load: loadImageNode},
+}
+
+func loadNode[T any](getLoader func(*middlewares.Loaders) *dataloader.Loader[int, *T]) nodeLoader {
+	return func(ctx context.Context, id int) func() (models.Node, error) {
+		thunk := getLoader(middlewares.For(ctx)).Load(ctx, id)
+		return func() (models.Node, error) {
+			result, err := thunk()
+			if err != nil {
+				return nil, err
+			}
+			return any(result).(models.Node), nil
+		}
+	}
+}
+
+// a product's image is only visible with the product, e.g. within branch scope
+func loadImageNode(ctx context.Context, id int) func() (models.Node, error) {
+	thunk := middlewares.For(ctx).ImageLoader.Load(ctx, id)
+	return func() (models.Node, error) {
+		image, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		if image.ReferenceType == "products" {
+			if _, err := middlewares.GetProduct(ctx, image.ReferenceID); err != nil {
+				return nil, err
+			}
+		}
+		return image, nil
+	}
+}
+
+// global ids of argument name as sent, the ID scalar only keeps their number
+func getGlobalIdArguments(ctx context.Context, name string) ([]models.GlobalID, error) {
+	fc := graphql.GetFieldContext(ctx)
+	raw := fc.Field.ArgumentMap(graphql.GetOperationContext(ctx).Variables)[name]
+
+	values, ok := raw.([]interface{})
+	if !ok {
+		values = []interface{}{raw}
+	}
+	globalIds := make([]models.GlobalID, 0, len(values))
+	for _, value := range values {
+		var globalId models.GlobalID
+		if err := globalId.UnmarshalGQL(value); err != nil {
+			return nil, fmt.Errorf("%s must be global ids: %w", name, err)
+		}
+		globalIds = append(globalIds, globalId)
+	}
+	return globalIds, nil
+}
+
+// nodes of globalIds through the dataloaders, in order
+// ids not found or out of scope give nil
+func getNodes(ctx context.Context, globalIds []models.GlobalID) ([]models.Node, error) {
+	if len(globalIds) > maxNodes {
+		return nil, fmt.Errorf("cannot fetch more than %d nodes", maxNodes)
+	}
+
+	allowed := make(map[string]bool)
+	for _, globalId := range globalIds {
+		nodeType, ok := nodeTypes[globalId.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown node type %s", globalId.Type)
+		}
+		if _, checked := allowed[nodeType.module]; checked {
+			continue
+		}
+		can, err := models.CanI(ctx, nodeType.module, "read")
+		if err != nil {
+			return nil, err
+		}
+		if !can {
+			return nil, errors.New("permission not allow")
+		}
+		allowed[nodeType.module] = true
+	}
+
+	// every load is queued before waiting, so each type is fetched in one batch
+	thunks := make([]func() (models.Node, error), 0, len(globalIds))
+	for _, globalId := range globalIds {
+		thunks = append(thunks, nodeTypes[globalId.Type].load(ctx, globalId.ID))
+	}
+	nodes := make([]models.Node, 0, len(globalIds))
+	for _, thunk := range thunks {
+		node, err := thunk()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			node, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+type permissionOperations struct {
+	queries   []string
+	mutations []string
+}
+
+var (
+	operationsByPermission     map[string]*permissionOperations
+	operationsByPermissionOnce sync.Once
+)
+
+// query & mutation fields gated by @hasPermission, keyed by models.PermissionKey
+func getPermissionOperations(module string, action string) *permissionOperations {
+	operationsByPermissionOnce.Do(func() {
+		operationsByPermission = make(map[string]*permissionOperations)
+		collect := func(def *ast.Definition, isMutation bool) {
+			if def == nil {
+				return
+			}
+			for _, field := range def.Fields {
+				directive := field.Directives.ForName("hasPermission")
+				if directive == nil {
+					continue
+				}
+				key := models.PermissionKey(
+					directive.Arguments.ForName("module").Value.Raw,
+					directive.Arguments.ForName("action").Value.Raw,
+				)
+				operations, ok := operationsByPermission[key]
+				if !ok {
+					operations = &permissionOperations{queries: []string{}, mutations: []string{}}
+					operationsByPermission[key] = operations
+				}
+				if isMutation {
+					operations.mutations = append(operations.mutations, field.Name)
+				} else {
+					operations.queries = append(operations.queries, field.Name)
+				}
+			}
+		}
+		collect(parsedSchema.Query, false)
+		collect(parsedSchema.Mutation, true)
+	})
+
+	if operations, ok := operationsByPermission[models.PermissionKey(module, action)]; ok {
+		return operations
+	}
+	return &permissionOperations{queries: []string{}, mutations: []string{}}
+}
+
+// every @hasPermission must name a registered module action, a typo would deny everyone
+func ValidatePermissionDirectives() error {
+	for _, def := range []*ast.Definition{parsedSchema.Query, parsedSchema.Mutation} {
+		if def == nil {
+			continue
+		}
+		for _, field := range def.Fields {
+			directive := field.Directives.ForName("hasPermission")
+			if directive == nil {
+				continue
+			}
+			module := directive.Arguments.ForName("module").Value.Raw
+			action := directive.Arguments.ForName("action").Value.Raw
+			if !models.IsRegisteredAction(module, action) {
+				return fmt.Errorf("%s.%s requires unregistered permission %s", def.Name, field.Name, models.PermissionKey(module, action))
+			}
+		}
+	}
+	return nil
+}
@@ -7,25 +7,36 @@ package graph
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/aungmyozaw92/go-graphql/middlewares"
 	"github.com/aungmyozaw92/go-graphql/models"
 )
 
+// Role is the resolver for the role field.
+func (r *apiKeyResolver) Role(ctx context.Context, obj *models.ApiKey) (*models.Role, error) {
+	return middlewares.GetRole(ctx, obj.RoleId)
+}
+
+// AllowedIps is the resolver for the allowedIps field.
+func (r *apiKeyResolver) AllowedIps(ctx context.Context, obj *models.ApiKey) ([]string, error) {
+	return obj.GetAllowedIps(), nil
+}
+
 // ParentCategory is the resolver for the parentCategory field.
 func (r *categoryResolver) ParentCategory(ctx context.Context, obj *models.Category) (*models.Category, error) {
 	return middlewares.GetCategory(ctx, obj.ParentCategoryId)
 }
 
 // Register is the resolver for the register field.
-func (r *mutationResolver) Register(ctx context.Context, input models.NewUser) (*models.User, error) {
-	return models.CreateUser(ctx, &input)
+func (r *mutationResolver) Register(ctx context.Context, input models.NewUser, businessID *string) (*models.User, error) {
+	return models.RegisterUser(ctx, &input, businessID)
 }
 
 // Login is the resolver for the login field.
-func (r *mutationResolver) Login(ctx context.Context, username string, password string) (*models.LoginInfo, error) {
-	return models.Login(ctx, username, password)
+func (r *mutationResolver) Login(ctx context.Context, username string, password string, businessID *string) (*models.LoginInfo, error) {
+	return models.Login(ctx, username, password, businessID)
 }
 
 // Logout is the resolver for the logout field.
@@ -33,6 +44,11 @@ func (r *mutationResolver) Logout(ctx context.Context) (bool, error) {
 	return models.Logout(ctx)
 }
 
+// LinkOidc is the resolver for the linkOidc field.
+func (r *mutationResolver) LinkOidc(ctx context.Context) (string, error) {
+	return models.StartOidcLink(ctx)
+}
+
 // CreateUser is the resolver for the createUser field.
 func (r *mutationResolver) CreateUser(ctx context.Context, input models.NewUser) (*models.User, error) {
 	return models.CreateUser(ctx, &input)
@@ -53,13 +69,24 @@ func (r *mutationResolver) ChangePassword(ctx context.Context, oldPassword strin
 	return models.ChangePassword(ctx, oldPassword, newPassword)
 }
 
+// ImpersonateUser is the resolver for the impersonateUser field.
+func (r *mutationResolver) ImpersonateUser(ctx context.Context, userID int, reason string) (*models.LoginInfo, error) {
+	return models.ImpersonateUser(ctx, userID, reason)
+}
+
 // CreateRole is the resolver for the createRole field.
 func (r *mutationResolver) CreateRole(ctx context.Context, input models.NewRole) (*models.Role, error) {
+	if err := validateFieldPermissions(input.FieldPermissions); err != nil {
+		return nil, err
+	}
 	return models.CreateRole(ctx, &input)
 }
 
 // UpdateRole is the resolver for the updateRole field.
 func (r *mutationResolver) UpdateRole(ctx context.Context, id int, input models.NewRole) (*models.Role, error) {
+	if err := validateFieldPermissions(input.FieldPermissions); err != nil {
+		return nil, err
+	}
 	return models.UpdateRole(ctx, id, &input)
 }
 
@@ -68,19 +95,29 @@ func (r *mutationResolver) DeleteRole(ctx context.Context, id int) (*models.Role
 	return models.DeleteRole(ctx, id)
 }
 
-// CreateModule is the resolver for the createModule field.
-func (r *mutationResolver) CreateModule(ctx context.Context, input models.NewModule) (*models.Module, error) {
-	return models.CreateModule(ctx, &input)
+// CreateAPIKey is the resolver for the createApiKey field.
+func (r *mutationResolver) CreateAPIKey(ctx context.Context, input models.NewApiKey) (*models.ApiKeyCreated, error) {
+	return models.CreateApiKey(ctx, &input)
+}
+
+// DeleteAPIKey is the resolver for the deleteApiKey field.
+func (r *mutationResolver) DeleteAPIKey(ctx context.Context, id int) (*models.ApiKey, error) {
+	return models.DeleteApiKey(ctx, id)
+}
+
+// CreateBranch is the resolver for the createBranch field.
+func (r *mutationResolver) CreateBranch(ctx context.Context, input models.NewBranch) (*models.Branch, error) {
+	return models.CreateBranch(ctx, &input)
 }
 
-// UpdateModule is the resolver for the updateModule field.
-func (r *mutationResolver) UpdateModule(ctx context.Context, id int, input models.NewModule) (*models.Module, error) {
-	return models.UpdateModule(ctx, id, &input)
+// UpdateBranch is the resolver for the updateBranch field.
+func (r *mutationResolver) UpdateBranch(ctx context.Context, id int, input models.NewBranch) (*models.Branch, error) {
+	return models.UpdateBranch(ctx, id, &input)
 }
 
-// DeleteModule is the resolver for the deleteModule field.
-func (r *mutationResolver) DeleteModule(ctx context.Context, id int) (*models.Module, error) {
-	return models.DeleteModule(ctx, id)
+// DeleteBranch is the resolver for the deleteBranch field.
+func (r *mutationResolver) DeleteBranch(ctx context.Context, id int) (*models.Branch, error) {
+	return models.DeleteBranch(ctx, id)
 }
 
 // CreateUnit is the resolver for the createUnit field.
@@ -145,7 +182,7 @@ func (r *mutationResolver) CreateProduct(ctx context.Context, input models.NewPr
 
 // UpdateProduct is the resolver for the updateProduct field.
 func (r *mutationResolver) UpdateProduct(ctx context.Context, id int, input models.NewProduct) (*models.Product, error) {
-	panic(fmt.Errorf("not implemented: UpdateProduct - updateProduct"))
+	return models.UpdateProduct(ctx, id, &input)
 }
 
 // DeleteProduct is the resolver for the deleteProduct field.
@@ -155,7 +192,12 @@ func (r *mutationResolver) DeleteProduct(ctx context.Context, id int) (*models.P
 
 // ToggleActiveProduct is the resolver for the toggleActiveProduct field.
 func (r *mutationResolver) ToggleActiveProduct(ctx context.Context, id int, isActive bool) (*models.Product, error) {
-	panic(fmt.Errorf("not implemented: ToggleActiveProduct - toggleActiveProduct"))
+	return models.ToggleActiveProduct(ctx, id, isActive)
+}
+
+// Branch is the resolver for the branch field.
+func (r *productResolver) Branch(ctx context.Context, obj *models.Product) (*models.Branch, error) {
+	return middlewares.GetBranch(ctx, obj.BranchId)
 }
 
 // Category is the resolver for the category field.
@@ -173,19 +215,46 @@ func (r *productResolver) Unit(ctx context.Context, obj *models.Product) (*model
 	return middlewares.GetUnit(ctx, obj.UnitId)
 }
 
+// PriceBands is the resolver for the priceBands field.
+func (r *productSearchFacetsResolver) PriceBands(ctx context.Context, obj *models.ProductSearchFacets) ([]*models.SearchFacetCount, error) {
+	return obj.GetPriceBands()
+}
+
+// Node is the resolver for the node field.
+func (r *queryResolver) Node(ctx context.Context, id int) (models.Node, error) {
+	globalIds, err := getGlobalIdArguments(ctx, "id")
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := getNodes(ctx, globalIds)
+	if err != nil {
+		return nil, err
+	}
+	return nodes[0], nil
+}
+
+// Nodes is the resolver for the nodes field.
+func (r *queryResolver) Nodes(ctx context.Context, ids []int) ([]models.Node, error) {
+	globalIds, err := getGlobalIdArguments(ctx, "ids")
+	if err != nil {
+		return nil, err
+	}
+	return getNodes(ctx, globalIds)
+}
+
 // GetUser is the resolver for the getUser field.
 func (r *queryResolver) GetUser(ctx context.Context, id int) (*models.User, error) {
 	return models.GetUser(ctx, id)
 }
 
 // GetUsers is the resolver for the getUsers field.
-func (r *queryResolver) GetUsers(ctx context.Context, name *string, phone *string, mobile *string, email *string, isActive *bool) ([]*models.User, error) {
-	return models.GetUsers(ctx, name, phone, mobile, email, isActive)
+func (r *queryResolver) GetUsers(ctx context.Context, filter *models.UserFilter, name *string, phone *string, mobile *string, email *string, isActive *bool) ([]*models.User, error) {
+	return models.GetUsers(ctx, models.UserFilterWithArgs(filter, name, phone, mobile, email, isActive))
 }
 
 // PaginateUser is the resolver for the paginateUser field.
-func (r *queryResolver) PaginateUser(ctx context.Context, limit *int, after *string, name *string, phone *string, mobile *string, email *string, isActive *bool) (*models.UsersConnection, error) {
-	return models.PaginateUser(ctx, limit, after, name, phone, mobile, email, isActive)
+func (r *queryResolver) PaginateUser(ctx context.Context, first *int, after *string, last *int, before *string, limit *int, orderBy []*models.UserOrder, filter *models.UserFilter, name *string, phone *string, mobile *string, email *string, isActive *bool) (*models.UsersConnection, error) {
+	return models.PaginateUser(ctx, models.PageArgs{First: first, After: after, Last: last, Before: before, Limit: limit}, orderBy, models.UserFilterWithArgs(filter, name, phone, mobile, email, isActive))
 }
 
 // GetModule is the resolver for the getModule field.
@@ -213,6 +282,50 @@ func (r *queryResolver) ListRoleModule(ctx context.Context, roleID *int) ([]*mod
 	panic(fmt.Errorf("not implemented: ListRoleModule - listRoleModule"))
 }
 
+// MyPermissions is the resolver for the myPermissions field.
+func (r *queryResolver) MyPermissions(ctx context.Context) ([]*models.Permission, error) {
+	permissions, err := models.GetMyPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, permission := range permissions {
+		operations := getPermissionOperations(permission.Module, permission.Action)
+		permission.Queries = operations.queries
+		permission.Mutations = operations.mutations
+	}
+	return permissions, nil
+}
+
+// CanI is the resolver for the canI field.
+func (r *queryResolver) CanI(ctx context.Context, module string, action string) (bool, error) {
+	return models.CanI(ctx, module, action)
+}
+
+// WhoCan is the resolver for the whoCan field.
+func (r *queryResolver) WhoCan(ctx context.Context, module string, action string) (*models.WhoCan, error) {
+	return models.GetWhoCan(ctx, module, action)
+}
+
+// GetAPIKey is the resolver for the getApiKey field.
+func (r *queryResolver) GetAPIKey(ctx context.Context, id int) (*models.ApiKey, error) {
+	return models.GetApiKey(ctx, id)
+}
+
+// GetAPIKeys is the resolver for the getApiKeys field.
+func (r *queryResolver) GetAPIKeys(ctx context.Context) ([]*models.ApiKey, error) {
+	return models.GetApiKeys(ctx)
+}
+
+// GetBranch is the resolver for the getBranch field.
+func (r *queryResolver) GetBranch(ctx context.Context, id int) (*models.Branch, error) {
+	return models.GetBranch(ctx, id)
+}
+
+// GetBranches is the resolver for the getBranches field.
+func (r *queryResolver) GetBranches(ctx context.Context) ([]*models.Branch, error) {
+	return models.GetBranches(ctx)
+}
+
 // GetUnit is the resolver for the getUnit field.
 func (r *queryResolver) GetUnit(ctx context.Context, id int) (*models.Unit, error) {
 	return models.GetUnit(ctx, id)
@@ -223,9 +336,14 @@ func (r *queryResolver) GetUnits(ctx context.Context, name *string) ([]*models.U
 	return models.GetUnits(ctx, name)
 }
 
+// AuditLog is the resolver for the auditLog field.
+func (r *queryResolver) AuditLog(ctx context.Context, first *int, after *string, last *int, before *string, limit *int, orderBy []*models.AuditLogOrder, entityType *string, entityID *string, userID *int, from *time.Time, to *time.Time) (*models.AuditLogsConnection, error) {
+	return models.PaginateAuditLog(ctx, models.PageArgs{First: first, After: after, Last: last, Before: before, Limit: limit}, orderBy, entityType, entityID, userID, from, to)
+}
+
 // PaginateUnit is the resolver for the paginateUnit field.
-func (r *queryResolver) PaginateUnit(ctx context.Context, limit *int, after *string, name *string) (*models.UnitsConnection, error) {
-	return models.PaginateUnit(ctx, limit, after, name)
+func (r *queryResolver) PaginateUnit(ctx context.Context, first *int, after *string, last *int, before *string, limit *int, orderBy []*models.UnitOrder, filter *models.UnitFilter, name *string) (*models.UnitsConnection, error) {
+	return models.PaginateUnit(ctx, models.PageArgs{First: first, After: after, Last: last, Before: before, Limit: limit}, orderBy, models.UnitFilterWithArgs(filter, name))
 }
 
 // GetCategory is the resolver for the getCategory field.
@@ -239,8 +357,8 @@ func (r *queryResolver) GetCategories(ctx context.Context, name *string) ([]*mod
 }
 
 // PaginateCategory is the resolver for the paginateCategory field.
-func (r *queryResolver) PaginateCategory(ctx context.Context, limit *int, after *string, name *string, parentCategoryID *int) (*models.CategoriesConnection, error) {
-	return models.PaginateCategory(ctx, limit, after, name, parentCategoryID)
+func (r *queryResolver) PaginateCategory(ctx context.Context, first *int, after *string, last *int, before *string, limit *int, orderBy []*models.CategoryOrder, filter *models.CategoryFilter, name *string, parentCategoryID *int) (*models.CategoriesConnection, error) {
+	return models.PaginateCategory(ctx, models.PageArgs{First: first, After: after, Last: last, Before: before, Limit: limit}, orderBy, models.CategoryFilterWithArgs(filter, name, parentCategoryID))
 }
 
 // GetProduct is the resolver for the getProduct field.
@@ -249,8 +367,8 @@ func (r *queryResolver) GetProduct(ctx context.Context, id int) (*models.Product
 }
 
 // PaginateProduct is the resolver for the paginateProduct field.
-func (r *queryResolver) PaginateProduct(ctx context.Context, limit *int, after *string, name *string, sku *string) (*models.ProductsConnection, error) {
-	panic(fmt.Errorf("not implemented: PaginateProduct - paginateProduct"))
+func (r *queryResolver) PaginateProduct(ctx context.Context, first *int, after *string, last *int, before *string, limit *int, orderBy []*models.ProductOrder, filter *models.ProductFilter, name *string, sku *string) (*models.ProductsConnection, error) {
+	return models.PaginateProduct(ctx, models.PageArgs{First: first, After: after, Last: last, Before: before, Limit: limit}, orderBy, models.ProductFilterWithArgs(filter, name, sku))
 }
 
 // GetProducts is the resolver for the getProducts field.
@@ -258,11 +376,38 @@ func (r *queryResolver) GetProducts(ctx context.Context, name *string) ([]*model
 	return models.GetProducts(ctx, name)
 }
 
+// SearchProducts is the resolver for the searchProducts field.
+func (r *queryResolver) SearchProducts(ctx context.Context, query string, filters *models.ProductSearchFilter, first *int, offset *int) (*models.ProductSearchResult, error) {
+	size, from := 20, 0
+	if first != nil {
+		size = *first
+	}
+	if offset != nil {
+		from = *offset
+	}
+	return models.SearchProducts(ctx, query, filters, size, from)
+}
+
 // RoleModules is the resolver for the roleModules field.
 func (r *roleResolver) RoleModules(ctx context.Context, obj *models.Role) ([]*models.RoleModule, error) {
 	panic(fmt.Errorf("not implemented: RoleModules - roleModules"))
 }
 
+// FieldPermissions is the resolver for the fieldPermissions field.
+func (r *roleResolver) FieldPermissions(ctx context.Context, obj *models.Role) ([]*models.FieldPermission, error) {
+	return models.GetFieldPermissions(ctx, obj.ID)
+}
+
+// ParentRoles is the resolver for the parentRoles field.
+func (r *roleResolver) ParentRoles(ctx context.Context, obj *models.Role) ([]*models.Role, error) {
+	return models.GetParentRoles(ctx, obj.ID)
+}
+
+// Permissions is the resolver for the permissions field.
+func (r *roleResolver) Permissions(ctx context.Context, obj *models.Role) ([]*models.RolePermission, error) {
+	return models.GetRolePermissionDetails(ctx, obj.ID)
+}
+
 // Role is the resolver for the role field.
 func (r *roleModuleResolver) Role(ctx context.Context, obj *models.RoleModule) (*models.Role, error) {
 	panic(fmt.Errorf("not implemented: Role - role"))
@@ -278,6 +423,24 @@ func (r *userResolver) Role(ctx context.Context, obj *models.User) (*models.Role
 	return middlewares.GetRole(ctx, obj.RoleId)
 }
 
+// RoleGrants is the resolver for the roleGrants field.
+func (r *userResolver) RoleGrants(ctx context.Context, obj *models.User) ([]*models.UserRole, error) {
+	return models.GetUserRoles(ctx, obj.ID)
+}
+
+// Branches is the resolver for the branches field.
+func (r *userResolver) Branches(ctx context.Context, obj *models.User) ([]*models.Branch, error) {
+	return models.GetUserBranches(ctx, obj.ID)
+}
+
+// Role is the resolver for the role field.
+func (r *userRoleResolver) Role(ctx context.Context, obj *models.UserRole) (*models.Role, error) {
+	return middlewares.GetRole(ctx, obj.RoleId)
+}
+
+// ApiKey returns ApiKeyResolver implementation.
+func (r *Resolver) ApiKey() ApiKeyResolver { return &apiKeyResolver{r} }
+
 // Category returns CategoryResolver implementation.
 func (r *Resolver) Category() CategoryResolver { return &categoryResolver{r} }
 
@@ -287,6 +450,11 @@ func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 // Product returns ProductResolver implementation.
 func (r *Resolver) Product() ProductResolver { return &productResolver{r} }
 
+// ProductSearchFacets returns ProductSearchFacetsResolver implementation.
+func (r *Resolver) ProductSearchFacets() ProductSearchFacetsResolver {
+	return &productSearchFacetsResolver{r}
+}
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
@@ -299,10 +467,16 @@ func (r *Resolver) RoleModule() RoleModuleResolver { return &roleModuleResolver{
 // User returns UserResolver implementation.
 func (r *Resolver) User() UserResolver { return &userResolver{r} }
 
+// UserRole returns UserRoleResolver implementation.
+func (r *Resolver) UserRole() UserRoleResolver { return &userRoleResolver{r} }
+
+type apiKeyResolver struct{ *Resolver }
 type categoryResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type productResolver struct{ *Resolver }
+type productSearchFacetsResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type roleResolver struct{ *Resolver }
 type roleModuleResolver struct{ *Resolver }
 type userResolver struct{ *Resolver }
+type userRoleResolver struct{ *Resolver }
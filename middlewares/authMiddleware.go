@@ -3,14 +3,13 @@ package middlewares
 import (
 	"context"
 	"net/http"
+	"strings"
 
-	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/models"
 	"github.com/aungmyozaw92/go-graphql/utils"
 	"github.com/gin-gonic/gin"
 )
 
-type authString string
-
 // func AuthMiddleware() gin.HandlerFunc {
 // 	return func(c *gin.Context) {
 // 		auth := c.Request.Header.Get("Authorization")
@@ -41,8 +40,31 @@ type authString string
 // 	}
 // }
 
+type apiKeyString string
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// machine to machine clients
+		if key := c.Request.Header.Get("X-API-Key"); key != "" {
+			apiKey, err := models.AuthenticateApiKey(c.Request.Context(), key, c.ClientIP())
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+				c.Abort()
+				return
+			}
+
+			ctx := context.WithValue(c.Request.Context(), apiKeyString("apiKey"), apiKey)
+			ctx = context.WithValue(ctx, utils.ContextKeyApiKeyId, apiKey.ID)
+			ctx = context.WithValue(ctx, utils.ContextKeyBusinessId, apiKey.BusinessId)
+			// api keys have no branch assignment, only roles with all branches see branch data
+			ctx = withBranchScope(ctx, func(context.Context) ([]int, error) {
+				return []int{apiKey.RoleId}, nil
+			}, 0)
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+			return
+		}
+
 		auth := c.Request.Header.Get("Authorization")
 
 		if auth == "" {
@@ -50,37 +72,71 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		bearer := "Bearer "
-		auth = auth[len(bearer):]
-
-		// Check if the token is blacklisted
-		_, exists, err := config.GetRedisValue(auth)
-		if err == nil && exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "token is invalidated"})
+		auth, found := strings.CutPrefix(auth, "Bearer ")
+		if !found {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			c.Abort()
 			return
 		}
 
-		// Validate the token
-		validate, err := utils.JwtValidate(auth)
-		if err != nil || !validate.Valid {
+		// Validate the token, issuer, audience & expiry
+		customClaim, err := utils.JwtValidate(auth)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			c.Abort()
 			return
 		}
 
-		customClaim, _ := validate.Claims.(*utils.JwtCustomClaim)
+		// Check if the token is revoked, a token that can't be checked is refused
+		revoked, err := models.IsTokenRevoked(c.Request.Context(), customClaim)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "cannot verify token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token is invalidated"})
+			c.Abort()
+			return
+		}
 
-		ctx := context.WithValue(c.Request.Context(), authString("auth"), customClaim)
-		ctx = context.WithValue(ctx, utils.ContextKeyUserId, customClaim.ID)
+		ctx := context.WithValue(c.Request.Context(), utils.ContextKeyClaim, customClaim)
+		ctx = context.WithValue(ctx, utils.ContextKeyUserId, customClaim.UserId)
 		ctx = context.WithValue(ctx, utils.ContextKeyToken, auth)
+		ctx = context.WithValue(ctx, utils.ContextKeyBusinessId, customClaim.BusinessId)
+		if customClaim.ImpersonatorId > 0 {
+			ctx = context.WithValue(ctx, utils.ContextKeyImpersonatorId, customClaim.ImpersonatorId)
+		}
+		ctx = withBranchScope(ctx, func(ctx context.Context) ([]int, error) {
+			return models.GetUserActiveRoleIds(ctx, customClaim.UserId)
+		}, customClaim.UserId)
 		c.Request = c.Request.WithContext(ctx)
 		c.Next()
 	}
 }
 
+// branch scope resolved on first use by a branch scoped query, from the caller's active roles
+func withBranchScope(ctx context.Context, roleIds func(context.Context) ([]int, error), userId int) context.Context {
+	scopeCtx := utils.WithoutBranchScope(ctx)
+	scope := utils.NewBranchScope(func() (bool, []int, error) {
+		activeRoleIds, err := roleIds(scopeCtx)
+		if err != nil {
+			return false, nil, err
+		}
+		return models.ResolveBranchScope(scopeCtx, activeRoleIds, userId)
+	})
+	return context.WithValue(ctx, utils.ContextKeyBranchScope, scope)
+}
+
 func CtxValue(ctx context.Context) *utils.JwtCustomClaim {
-	raw, _ := ctx.Value(authString("auth")).(*utils.JwtCustomClaim)
+	raw, _ := utils.GetClaimFromContext(ctx)
+	return raw
+}
+
+// api key authenticated by X-API-Key header, nil for user requests
+func ApiKeyValue(ctx context.Context) *models.ApiKey {
+	raw, _ := ctx.Value(apiKeyString("apiKey")).(*models.ApiKey)
 	return raw
 }
 
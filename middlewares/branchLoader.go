@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"context"
+
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/graph-gophers/dataloader/v7"
+	"gorm.io/gorm"
+)
+
+// branchReader reads Branch from a database
+type branchReader struct {
+	db *gorm.DB
+}
+
+// getBranches implements a batch function that can retrieve many Branches by ID,
+// for use in a dataloader
+
+func (u *branchReader) getBranches(ctx context.Context, ids []int) []*dataloader.Result[*models.Branch] {
+	var results []*models.Branch
+
+	err := u.db.WithContext(ctx).Where("id IN ?", ids).Find(&results).Error
+	if err != nil {
+		// Instead of returning []error, create a single error for the dataloader.Result
+		return handleError[*models.Branch](len(ids), err)
+	}
+
+	return generateLoaderResults(results, ids)
+}
+
+// GetBranch returns single Branch by id efficiently
+
+func GetBranch(ctx context.Context, id int) (*models.Branch, error) {
+	loaders := For(ctx)
+	return loaders.BranchLoader.Load(ctx, id)()
+}
+
+// GetBranches returns many Branches by ids efficiently
+func GetBranches(ctx context.Context, ids []int) ([]*models.Branch, []error) {
+	loaders := For(ctx)
+	return loaders.BranchLoader.LoadMany(ctx, ids)()
+}
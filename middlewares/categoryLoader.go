@@ -17,28 +17,14 @@ type categoryReader struct {
 // for use in a dataloader
 
 func (u *categoryReader) getCategories(ctx context.Context, ids []int) []*dataloader.Result[*models.Category] {
-	var results []*models.Category
-
-	err := u.db.WithContext(ctx).Where("id IN ?", ids).Find(&results).Error
+	// served from the cache, misses are fetched in one query
+	results, err := models.GetResourcesByIds[models.Category](ctx, ids)
 	if err != nil {
 		// Instead of returning []error, create a single error for the dataloader.Result
 		return handleError[*models.Category](len(ids), err)
 	}
 
-	loaderResults := make([]*dataloader.Result[*models.Category], 0, len(ids))
-	for _, id := range ids {
-		if id == 0 {
-			loaderResults = append(loaderResults, &dataloader.Result[*models.Category]{Data: &models.Category{}})
-		} else {
-			for _, result := range results {
-				if result.ID == id {
-					loaderResults = append(loaderResults, &dataloader.Result[*models.Category]{Data: result})
-					break
-				}
-			}
-		}
-	}
-	return loaderResults
+	return generateLoaderResults(results, ids)
 }
 
 // GetCategory returns single Category by id efficiently
@@ -22,6 +22,16 @@ func (r *imageReader) GetImages(ctx context.Context, referenceIds []int) []*data
 	return generateLoaderArrayResults(results, referenceIds)
 }
 
+// images by their own id, whatever they belong to
+func (r *imageReader) getImagesByIds(ctx context.Context, ids []int) []*dataloader.Result[*models.Image] {
+	var results []*models.Image
+	if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&results).Error; err != nil {
+		return handleError[*models.Image](len(ids), err)
+	}
+
+	return generateLoaderResults(results, ids)
+}
+
 func GetImages(ctx context.Context, referenceType string, referenceId int) ([]*models.Image, error) {
 	loaders := For(ctx)
 	var imageLoader *dataloader.Loader[int, []*models.Image]
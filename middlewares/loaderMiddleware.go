@@ -24,6 +24,9 @@ type Loaders struct {
 	RoleLoader 				*dataloader.Loader[int, *models.Role]
 	CategoryLoader 			*dataloader.Loader[int, *models.Category]
 	UnitLoader 				*dataloader.Loader[int, *models.Unit]
+	BranchLoader 			*dataloader.Loader[int, *models.Branch]
+	ProductLoader 			*dataloader.Loader[int, *models.Product]
+	ImageLoader 			*dataloader.Loader[int, *models.Image]
 	ProductImageLoader      *dataloader.Loader[int, []*models.Image]
 }
 
@@ -34,6 +37,8 @@ func NewLoaders(conn *gorm.DB) *Loaders {
 	rr := &roleReader{db: conn}
 	cr := &categoryReader{db: conn}
 	unitr := &unitReader{db: conn}
+	br := &branchReader{db: conn}
+	pr := &productReader{db: conn}
 	pImager := &imageReader{db: conn, referenceType: "products"}
 
 	return &Loaders{
@@ -41,6 +46,9 @@ func NewLoaders(conn *gorm.DB) *Loaders {
 		RoleLoader: dataloader.NewBatchedLoader(rr.getRoles, dataloader.WithWait[int, *models.Role](time.Millisecond)),
 		CategoryLoader: dataloader.NewBatchedLoader(cr.getCategories, dataloader.WithWait[int, *models.Category](time.Millisecond)),
 		UnitLoader: dataloader.NewBatchedLoader(unitr.getUnits, dataloader.WithWait[int, *models.Unit](time.Millisecond)),
+		BranchLoader: dataloader.NewBatchedLoader(br.getBranches, dataloader.WithWait[int, *models.Branch](time.Millisecond)),
+		ProductLoader: dataloader.NewBatchedLoader(pr.getProducts, dataloader.WithWait[int, *models.Product](time.Millisecond)),
+		ImageLoader: dataloader.NewBatchedLoader(pImager.getImagesByIds, dataloader.WithWait[int, *models.Image](time.Millisecond)),
 		// ProductImageLoader: dataloader.NewBatchedLoader(pImager.GetImages, dataloader.WithWait[int, *models.Image](time.Millisecond)),
 		ProductImageLoader: dataloader.NewBatchedLoader(pImager.GetImages, dataloader.WithWait[int, []*models.Image](time.Millisecond)),
 
@@ -79,6 +87,26 @@ func handleError[T any](count int, err error) []*dataloader.Result[T] {
 	return results
 }
 
+// one result per id in order, as dataloader expects
+// ids not found get gorm.ErrRecordNotFound, id 0 an empty T
+func generateLoaderResults[T models.Identifier](results []*T, ids []int) []*dataloader.Result[*T] {
+	resultMap := make(map[int]*T, len(results))
+	for _, result := range results {
+		resultMap[(*result).GetId()] = result
+	}
+	loaderResults := make([]*dataloader.Result[*T], 0, len(ids))
+	for _, id := range ids {
+		if id == 0 {
+			loaderResults = append(loaderResults, &dataloader.Result[*T]{Data: new(T)})
+		} else if result, ok := resultMap[id]; ok {
+			loaderResults = append(loaderResults, &dataloader.Result[*T]{Data: result})
+		} else {
+			loaderResults = append(loaderResults, &dataloader.Result[*T]{Error: gorm.ErrRecordNotFound})
+		}
+	}
+	return loaderResults
+}
+
 // T must be struct
 // each id has many related results
 func generateLoaderArrayResults[T models.RelatedData](results []T, referenceIds []int) (loaderResults []*dataloader.Result[[]*T]) {
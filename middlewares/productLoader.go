@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"context"
+
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/graph-gophers/dataloader/v7"
+	"gorm.io/gorm"
+)
+
+// productReader reads Products from a database
+type productReader struct {
+	db *gorm.DB
+}
+
+// getProducts implements a batch function that can retrieve many Products by ID,
+// for use in a dataloader
+
+func (u *productReader) getProducts(ctx context.Context, ids []int) []*dataloader.Result[*models.Product] {
+	// served from the cache, misses are fetched in one query, out of branch scope ones are left out
+	results, err := models.GetResourcesByIds[models.Product](ctx, ids)
+	if err != nil {
+		// Instead of returning []error, create a single error for the dataloader.Result
+		return handleError[*models.Product](len(ids), err)
+	}
+
+	return generateLoaderResults(results, ids)
+}
+
+// GetProduct returns single Product by id efficiently
+
+func GetProduct(ctx context.Context, id int) (*models.Product, error) {
+	loaders := For(ctx)
+	return loaders.ProductLoader.Load(ctx, id)()
+}
+
+// GetProducts returns many Products by ids efficiently
+func GetProducts(ctx context.Context, ids []int) ([]*models.Product, []error) {
+	loaders := For(ctx)
+	return loaders.ProductLoader.LoadMany(ctx, ids)()
+}
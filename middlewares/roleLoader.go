@@ -25,20 +25,7 @@ func (u *roleReader) getRoles(ctx context.Context, ids []int) []*dataloader.Resu
 		return handleError[*models.Role](len(ids), err)
 	}
 
-	loaderResults := make([]*dataloader.Result[*models.Role], 0, len(ids))
-	for _, id := range ids {
-		if id == 0 {
-			loaderResults = append(loaderResults, &dataloader.Result[*models.Role]{Data: &models.Role{}})
-		} else {
-			for _, result := range results {
-				if result.ID == id {
-					loaderResults = append(loaderResults, &dataloader.Result[*models.Role]{Data: result})
-					break
-				}
-			}
-		}
-	}
-	return loaderResults
+	return generateLoaderResults(results, ids)
 }
 
 // GetRole returns single Role by id efficiently
@@ -17,28 +17,14 @@ type unitReader struct {
 // for use in a dataloader
 
 func (u *unitReader) getUnits(ctx context.Context, ids []int) []*dataloader.Result[*models.Unit] {
-	var results []*models.Unit
-
-	err := u.db.WithContext(ctx).Where("id IN ?", ids).Find(&results).Error
+	// served from the cache, misses are fetched in one query
+	results, err := models.GetResourcesByIds[models.Unit](ctx, ids)
 	if err != nil {
 		// Instead of returning []error, create a single error for the dataloader.Result
 		return handleError[*models.Unit](len(ids), err)
 	}
 
-	loaderResults := make([]*dataloader.Result[*models.Unit], 0, len(ids))
-	for _, id := range ids {
-		if id == 0 {
-			loaderResults = append(loaderResults, &dataloader.Result[*models.Unit]{Data: &models.Unit{}})
-		} else {
-			for _, result := range results {
-				if result.ID == id {
-					loaderResults = append(loaderResults, &dataloader.Result[*models.Unit]{Data: result})
-					break
-				}
-			}
-		}
-	}
-	return loaderResults
+	return generateLoaderResults(results, ids)
 }
 
 // GetUnit returns single Unit by id efficiently
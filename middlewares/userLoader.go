@@ -25,20 +25,7 @@ func (u *userReader) getUsers(ctx context.Context, ids []int) []*dataloader.Resu
 		return handleError[*models.User](len(ids), err)
 	}
 
-	loaderResults := make([]*dataloader.Result[*models.User], 0, len(ids))
-	for _, id := range ids {
-		if id == 0 {
-			loaderResults = append(loaderResults, &dataloader.Result[*models.User]{Data: &models.User{}})
-		} else {
-			for _, result := range results {
-				if result.ID == id {
-					loaderResults = append(loaderResults, &dataloader.Result[*models.User]{Data: result})
-					break
-				}
-			}
-		}
-	}
-	return loaderResults
+	return generateLoaderResults(results, ids)
 }
 
 // GetUser returns single user by id efficiently
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+)
+
+type ApiKey struct {
+	ID         int        `gorm:"primary_key" json:"id"`
+	BusinessId string     `gorm:"index;size:36;not null" json:"business_id"`
+	Name       string     `gorm:"size:100;not null" json:"name" binding:"required"`
+	Prefix     string     `gorm:"size:20;not null;uniqueIndex" json:"prefix"`
+	SecretHash string     `gorm:"size:64;not null" json:"-"`
+	RoleId     int        `gorm:"index;not null" json:"role_id" binding:"required"`
+	AllowedIps string     `gorm:"size:255" json:"allowed_ips"` // comma separated ip or cidr
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	IsActive   *bool      `gorm:"not null;default:true" json:"is_active"`
+	CreatedBy  int        `gorm:"not null;default:0" json:"created_by"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type NewApiKey struct {
+	Name       string     `json:"name" binding:"required"`
+	RoleId     int        `json:"role_id" binding:"required"`
+	AllowedIps []string   `json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// plain key is only returned once, on creation
+type ApiKeyCreated struct {
+	Key    string  `json:"key"`
+	ApiKey *ApiKey `json:"api_key"`
+}
+
+// don't write last_used_at more often than this
+const apiKeyLastUsedInterval = time.Minute
+
+func (k ApiKey) GetAllowedIps() []string {
+	if k.AllowedIps == "" {
+		return []string{}
+	}
+	return strings.Split(k.AllowedIps, ",")
+}
+
+func (input *NewApiKey) validate(ctx context.Context) error {
+	if strings.TrimSpace(input.Name) == "" {
+		return errors.New("name is required")
+	}
+	if err := utils.ValidateResourceId[Role](ctx, input.RoleId); err != nil {
+		return err
+	}
+	if err := ensureRoleWithinCaller(ctx, input.RoleId); err != nil {
+		return err
+	}
+	if err := utils.ValidateIpAllowlist(input.AllowedIps); err != nil {
+		return err
+	}
+	if input.ExpiresAt != nil && input.ExpiresAt.Before(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
+
+func CreateApiKey(ctx context.Context, input *NewApiKey) (*ApiKeyCreated, error) {
+
+	if err := input.validate(ctx); err != nil {
+		return nil, err
+	}
+
+	key, prefix, secretHash, err := utils.GenerateApiKey()
+	if err != nil {
+		return nil, err
+	}
+
+	userId, _ := utils.GetUserIdFromContext(ctx)
+	apiKey := ApiKey{
+		Name:       input.Name,
+		Prefix:     prefix,
+		SecretHash: secretHash,
+		RoleId:     input.RoleId,
+		AllowedIps: strings.Join(input.AllowedIps, ","),
+		ExpiresAt:  input.ExpiresAt,
+		IsActive:   utils.NewTrue(),
+		CreatedBy:  userId,
+	}
+
+	db := config.GetDB()
+	if err := db.WithContext(ctx).Create(&apiKey).Error; err != nil {
+		return nil, err
+	}
+
+	return &ApiKeyCreated{
+		Key:    key,
+		ApiKey: &apiKey,
+	}, nil
+}
+
+// revoke api key
+func DeleteApiKey(ctx context.Context, id int) (*ApiKey, error) {
+
+	var apiKey ApiKey
+	db := config.GetDB()
+
+	if err := db.WithContext(ctx).First(&apiKey, id).Error; err != nil {
+		return nil, err
+	}
+	if err := db.WithContext(ctx).Delete(&apiKey).Error; err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+func GetApiKey(ctx context.Context, id int) (*ApiKey, error) {
+
+	db := config.GetDB()
+	var result ApiKey
+
+	if err := db.WithContext(ctx).First(&result, id).Error; err != nil {
+		return nil, errors.New("record not found")
+	}
+	return &result, nil
+}
+
+func GetApiKeys(ctx context.Context) ([]*ApiKey, error) {
+
+	db := config.GetDB()
+	var results []*ApiKey
+
+	if err := db.WithContext(ctx).Order("created_at").Find(&results).Error; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// validate X-API-Key header value, returns the api key if usable from clientIp
+func AuthenticateApiKey(ctx context.Context, key string, clientIp string) (*ApiKey, error) {
+
+	prefix, secret, err := utils.ParseApiKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	db := config.GetDB()
+	var apiKey ApiKey
+	// the key names its business, it's looked up across every business
+	if err := db.WithContext(utils.WithoutTenant(ctx)).Where("prefix = ?", prefix).Take(&apiKey).Error; err != nil {
+		return nil, errors.New("invalid api key")
+	}
+	ctx = utils.WithBusiness(ctx, apiKey.BusinessId)
+	if !utils.CompareApiKeySecret(apiKey.SecretHash, secret) {
+		return nil, errors.New("invalid api key")
+	}
+	if apiKey.IsActive != nil && !*apiKey.IsActive {
+		return nil, errors.New("api key is disabled")
+	}
+	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("api key has expired")
+	}
+	if !utils.IsIpAllowed(apiKey.GetAllowedIps(), clientIp) {
+		return nil, errors.New("ip address is not allowed")
+	}
+
+	// last used tracking
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyLastUsedInterval {
+		if err := db.WithContext(ctx).Model(&apiKey).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &apiKey, nil
+}
@@ -0,0 +1,423 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// change of an entity by a mutation, or the mutation alone when it changed no entity
+type AuditLog struct {
+	ID             int       `gorm:"primary_key" json:"id"`
+	BusinessId     string    `gorm:"index;size:36;not null" json:"business_id"`
+	UserId         int       `gorm:"index;not null;default:0" json:"user_id"`
+	ApiKeyId       int       `gorm:"not null;default:0" json:"api_key_id"`
+	ImpersonatorId int       `gorm:"index;not null;default:0" json:"impersonator_id"` // real user behind UserId
+	Operation      string    `gorm:"size:255;not null" json:"operation"`
+	Variables      string    `gorm:"type:text" json:"variables"`
+	EntityType     string    `gorm:"size:100;index:idx_audit_logs_entity" json:"entity_type"`
+	EntityId       string    `gorm:"size:100;index:idx_audit_logs_entity" json:"entity_id"`
+	Action         string    `gorm:"size:20" json:"action"`
+	Before         string    `gorm:"type:text" json:"before"`
+	After          string    `gorm:"type:text" json:"after"`
+	Diff           string    `gorm:"type:text" json:"diff"`
+	CreatedAt      time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+type AuditLogsEdge Edge[AuditLog]
+
+type AuditLogsConnection struct {
+	PageInfo *PageInfo        `json:"pageInfo"`
+	Edges    []*AuditLogsEdge `json:"edges"`
+	TotalCounter
+}
+
+// sortable fields of auditLog
+type AuditLogOrderField string
+
+const (
+	AuditLogOrderFieldCreatedAt  AuditLogOrderField = "CREATED_AT"
+	AuditLogOrderFieldEntityType AuditLogOrderField = "ENTITY_TYPE"
+	AuditLogOrderFieldAction     AuditLogOrderField = "ACTION"
+)
+
+func (f AuditLogOrderField) column() (string, bool) {
+	switch f {
+	case AuditLogOrderFieldCreatedAt:
+		return "created_at", true
+	case AuditLogOrderFieldEntityType:
+		return "entity_type", true
+	case AuditLogOrderFieldAction:
+		return "action", true
+	}
+	return "", false
+}
+
+func (f AuditLogOrderField) MarshalGQL(w io.Writer) {
+	w.Write([]byte(strconv.Quote(string(f))))
+}
+
+func (f *AuditLogOrderField) UnmarshalGQL(i interface{}) error {
+	return unmarshalOrderField(i, f)
+}
+
+type AuditLogOrder struct {
+	OrderBy[AuditLogOrderField]
+}
+
+
+func (log AuditLog) GetBusinessId() string {
+	return log.BusinessId
+}
+
+// mutation or impersonated operation being audited, carried in context from the graphql operation to the gorm callbacks
+type AuditOperation struct {
+	Name      string
+	Variables string
+	entries   atomic.Int32
+}
+
+func WithAuditOperation(ctx context.Context, name string, variables map[string]interface{}) context.Context {
+	operation := &AuditOperation{
+		Name:      name,
+		Variables: redactedJson(variables),
+	}
+	return context.WithValue(ctx, utils.ContextKeyAuditOperation, operation)
+}
+
+func getAuditOperation(ctx context.Context) *AuditOperation {
+	operation, _ := ctx.Value(utils.ContextKeyAuditOperation).(*AuditOperation)
+	return operation
+}
+
+// record the operation itself when none of its entity changes were recorded
+func WriteAuditOperation(ctx context.Context) error {
+	operation := getAuditOperation(ctx)
+	if operation == nil || operation.entries.Load() > 0 {
+		return nil
+	}
+	// not yet authenticated mutations (login) have no business to record them in
+	if _, ok := utils.GetBusinessIdFromContext(ctx); !ok {
+		return nil
+	}
+	entry := newAuditLog(ctx, operation)
+	return config.GetDB().WithContext(ctx).Create(&entry).Error
+}
+
+func newAuditLog(ctx context.Context, operation *AuditOperation) AuditLog {
+	userId, _ := utils.GetUserIdFromContext(ctx)
+	apiKeyId, _ := utils.GetApiKeyIdFromContext(ctx)
+	impersonatorId, _ := utils.GetImpersonatorIdFromContext(ctx)
+	return AuditLog{
+		UserId:         userId,
+		ApiKeyId:       apiKeyId,
+		ImpersonatorId: impersonatorId,
+		Operation:      operation.Name,
+		Variables:      operation.Variables,
+	}
+}
+
+var redactedKeys = []string{"password", "secret", "token"}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[key] = redactValue(item)
+			for _, secret := range redactedKeys {
+				if strings.Contains(strings.ToLower(key), secret) {
+					redacted[key] = "[REDACTED]"
+					break
+				}
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(item)
+		}
+		return redacted
+	}
+	return value
+}
+
+// json with secret looking keys redacted, at any depth
+func redactedJson(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	// round trip so structs are redacted by their json keys
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return ""
+	}
+	if m, ok := decoded.(map[string]interface{}); ok && len(m) == 0 {
+		return ""
+	}
+	raw, _ = json.Marshal(redactValue(decoded))
+	return string(raw)
+}
+
+func toJsonMap(value interface{}) map[string]interface{} {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil
+	}
+	return redactValue(decoded).(map[string]interface{})
+}
+
+// changed fields as {field: {before, after}}, updated_at left out
+func auditDiff(before map[string]interface{}, after map[string]interface{}) map[string]interface{} {
+	diff := make(map[string]interface{})
+	for key, afterValue := range after {
+		if key == "updated_at" {
+			continue
+		}
+		if beforeValue := before[key]; !reflect.DeepEqual(beforeValue, afterValue) {
+			diff[key] = map[string]interface{}{"before": beforeValue, "after": afterValue}
+		}
+	}
+	for key, beforeValue := range before {
+		if _, ok := after[key]; !ok {
+			diff[key] = map[string]interface{}{"before": beforeValue, "after": nil}
+		}
+	}
+	return diff
+}
+
+/* gorm callbacks */
+
+const auditBeforeKey = "audit:before"
+
+// record creates, updates & deletes of single entities made by an audited mutation, in the statement's transaction
+func RegisterAuditLog(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").
+		Register("audit:create", auditCreate); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("audit:before_update", auditCaptureBefore); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").
+		Register("audit:update", auditUpdate); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("audit:before_delete", auditCaptureBefore); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").
+		Register("audit:delete", auditDelete); err != nil {
+		return err
+	}
+	return nil
+}
+
+// entities with a single primary key, join tables & the audit log itself are left out
+func isAudited(db *gorm.DB) bool {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Context == nil {
+		return false
+	}
+	if getAuditOperation(db.Statement.Context) == nil {
+		return false
+	}
+	schema := db.Statement.Schema
+	if len(schema.PrimaryFields) != 1 || schema.ModelType == reflect.TypeOf(AuditLog{}) {
+		return false
+	}
+	return true
+}
+
+// primary key of the statement's single record, empty for batch statements
+func auditEntityId(db *gorm.DB) string {
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	if rv.Kind() != reflect.Struct {
+		return ""
+	}
+	value, zero := db.Statement.Schema.PrioritizedPrimaryField.ValueOf(db.Statement.Context, rv)
+	if zero {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// current row of the entity, read in the statement's transaction
+func auditLoad(db *gorm.DB, id string) map[string]interface{} {
+	record := reflect.New(db.Statement.Schema.ModelType).Interface()
+	tx := db.Session(&gorm.Session{NewDB: true, Context: utils.WithoutBranchScope(db.Statement.Context)})
+	if err := tx.Where(db.Statement.Schema.PrioritizedPrimaryField.DBName+" = ?", id).Take(record).Error; err != nil {
+		return nil
+	}
+	return toJsonMap(record)
+}
+
+func auditWrite(db *gorm.DB, action string, id string, before map[string]interface{}, after map[string]interface{}, diff map[string]interface{}) {
+	ctx := db.Statement.Context
+	operation := getAuditOperation(ctx)
+	entry := newAuditLog(ctx, operation)
+	entry.EntityType = db.Statement.Schema.Name
+	entry.EntityId = id
+	entry.Action = action
+	if before != nil {
+		entry.Before = redactedJson(before)
+	}
+	if after != nil {
+		entry.After = redactedJson(after)
+	}
+	if diff != nil {
+		entry.Diff = redactedJson(diff)
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true, Context: ctx})
+	if err := tx.Create(&entry).Error; err != nil {
+		// fails the statement, so the change is rolled back with its transaction
+		db.AddError(fmt.Errorf("cannot write audit log: %w", err))
+		return
+	}
+	operation.entries.Add(1)
+}
+
+func auditCreate(db *gorm.DB) {
+	if !isAudited(db) {
+		return
+	}
+	field := db.Statement.Schema.PrioritizedPrimaryField
+	write := func(rv reflect.Value) {
+		rv = reflect.Indirect(rv)
+		if rv.Kind() != reflect.Struct {
+			return
+		}
+		value, zero := field.ValueOf(db.Statement.Context, rv)
+		if zero {
+			return
+		}
+		auditWrite(db, AuditActionCreate, fmt.Sprint(value), nil, toJsonMap(rv.Interface()), nil)
+	}
+
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			write(rv.Index(i))
+		}
+	case reflect.Struct:
+		write(rv)
+	}
+}
+
+func auditCaptureBefore(db *gorm.DB) {
+	if !isAudited(db) {
+		return
+	}
+	if id := auditEntityId(db); id != "" {
+		if before := auditLoad(db, id); before != nil {
+			db.InstanceSet(auditBeforeKey, before)
+		}
+	}
+}
+
+func auditUpdate(db *gorm.DB) {
+	if !isAudited(db) {
+		return
+	}
+	value, ok := db.InstanceGet(auditBeforeKey)
+	if !ok {
+		return
+	}
+	before := value.(map[string]interface{})
+	id := auditEntityId(db)
+	after := auditLoad(db, id)
+	if after == nil {
+		return
+	}
+	diff := auditDiff(before, after)
+	if len(diff) == 0 {
+		return
+	}
+	auditWrite(db, AuditActionUpdate, id, before, after, diff)
+}
+
+func auditDelete(db *gorm.DB) {
+	if !isAudited(db) || db.Statement.RowsAffected == 0 {
+		return
+	}
+	value, ok := db.InstanceGet(auditBeforeKey)
+	if !ok {
+		return
+	}
+	auditWrite(db, AuditActionDelete, auditEntityId(db), value.(map[string]interface{}), nil, nil)
+}
+
+/* query */
+
+func PaginateAuditLog(ctx context.Context, args PageArgs, orderBy []*AuditLogOrder,
+	entityType *string, entityId *string, userId *int, from *time.Time, to *time.Time,
+) (*AuditLogsConnection, error) {
+
+	db := config.GetDB()
+	dbCtx := db.WithContext(ctx)
+
+	if entityType != nil && *entityType != "" {
+		dbCtx = dbCtx.Where("entity_type = ?", *entityType)
+	}
+	if entityId != nil && *entityId != "" {
+		dbCtx = dbCtx.Where("entity_id = ?", *entityId)
+	}
+	if userId != nil {
+		// acting as someone else or being impersonated
+		dbCtx = dbCtx.Where("user_id = ? OR impersonator_id = ?", *userId, *userId)
+	}
+	if from != nil {
+		dbCtx = dbCtx.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		dbCtx = dbCtx.Where("created_at <= ?", *to)
+	}
+
+	// newest first, ids only grow
+	orders, err := getPageOrders(ctx, orderBy, PageOrder{Column: "id", Desc: true})
+	if err != nil {
+		return nil, err
+	}
+	edges, pageInfo, counter, err := FetchPage[AuditLog](dbCtx, args, orders...)
+	if err != nil {
+		return nil, err
+	}
+
+	var auditLogsConnection AuditLogsConnection
+	auditLogsConnection.PageInfo = pageInfo
+	auditLogsConnection.TotalCounter = counter
+
+	for _, edge := range edges {
+		auditLogsEdge := AuditLogsEdge(edge)
+		auditLogsConnection.Edges = append(auditLogsConnection.Edges, &auditLogsEdge)
+	}
+
+	return &auditLogsConnection, nil
+}
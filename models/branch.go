@@ -0,0 +1,251 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm"
+)
+
+type Branch struct {
+	ID        int       `gorm:"primary_key" json:"id"`
+	BusinessId string   `gorm:"index;size:36;not null" json:"business_id"`
+	Name      string    `gorm:"size:100;not null" json:"name" binding:"required"`
+	Address   string    `gorm:"type:text" json:"address"`
+	IsActive  *bool     `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type NewBranch struct {
+	Name    string `json:"name" binding:"required"`
+	Address string `json:"address"`
+}
+
+// user to branch assignment
+type UserBranch struct {
+	UserId    int       `gorm:"primary_key;autoIncrement:false;not null" json:"user_id"`
+	BranchId  int       `gorm:"primary_key;autoIncrement:false;not null" json:"branch_id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (branch Branch) GetId() int {
+	return branch.ID
+}
+
+func (input *NewBranch) validate(ctx context.Context, id int) error {
+	if err := utils.ValidateUnique[Branch](ctx, "name", input.Name, id); err != nil {
+		return err
+	}
+	return nil
+}
+
+func CreateBranch(ctx context.Context, input *NewBranch) (*Branch, error) {
+
+	if err := input.validate(ctx, 0); err != nil {
+		return nil, err
+	}
+
+	branch := Branch{
+		Name:     input.Name,
+		Address:  input.Address,
+		IsActive: utils.NewTrue(),
+	}
+
+	db := config.GetDB()
+	if err := db.WithContext(ctx).Create(&branch).Error; err != nil {
+		return nil, err
+	}
+
+	// remove Cache for Branch in Redis
+	if err := utils.InvalidateRedis[Branch](ctx); err != nil {
+		return nil, err
+	}
+
+	return &branch, nil
+}
+
+func UpdateBranch(ctx context.Context, id int, input *NewBranch) (*Branch, error) {
+
+	if err := input.validate(ctx, id); err != nil {
+		return nil, err
+	}
+
+	var branch Branch
+
+	db := config.GetDB()
+	if err := db.WithContext(ctx).First(&branch, id).Error; err != nil {
+		return nil, err
+	}
+
+	err := db.WithContext(ctx).Model(&branch).Updates(map[string]interface{}{
+		"Name":    input.Name,
+		"Address": input.Address,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// remove Cache for Branch in Redis
+	if err := utils.InvalidateRedis[Branch](ctx, branch.ID); err != nil {
+		return nil, err
+	}
+
+	return &branch, nil
+}
+
+func DeleteBranch(ctx context.Context, id int) (*Branch, error) {
+
+	var branch Branch
+
+	db := config.GetDB()
+	if err := db.WithContext(ctx).First(&branch, id).Error; err != nil {
+		return nil, err
+	}
+
+	// don't delete if branch still has products, counted across every branch
+	count, err := utils.ResourceCountWhere[Product](utils.WithoutBranchScope(ctx), "branch_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("used by product")
+	}
+
+	tx := db.Begin()
+	if err := tx.WithContext(ctx).Where("branch_id = ?", id).Delete(&UserBranch{}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.WithContext(ctx).Delete(&branch).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	// remove Cache for Branch in Redis
+	if err := utils.InvalidateRedis[Branch](ctx, branch.ID); err != nil {
+		return nil, err
+	}
+
+	return &branch, nil
+}
+
+func GetBranch(ctx context.Context, id int) (*Branch, error) {
+
+	return GetResource[Branch](ctx, id)
+}
+
+func GetBranches(ctx context.Context) ([]*Branch, error) {
+
+	return GetResources[Branch](ctx, "name")
+}
+
+// branches assigned to user
+func GetUserBranches(ctx context.Context, userId int) ([]*Branch, error) {
+
+	db := config.GetDB()
+	var results []*Branch
+
+	err := db.WithContext(ctx).
+		Joins("JOIN user_branches ON user_branches.branch_id = branches.id").
+		Where("user_branches.user_id = ?", userId).
+		Order("branches.name").
+		Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// whether any of the roles bypasses branch scoping, otherwise the user's assigned branches
+func ResolveBranchScope(ctx context.Context, roleIds []int, userId int) (bool, []int, error) {
+
+	db := config.GetDB()
+	var count int64
+	if err := db.WithContext(ctx).Model(&Role{}).
+		Where("id IN ? AND all_branches = ?", roleIds, true).
+		Count(&count).Error; err != nil {
+		return false, nil, err
+	}
+	if count > 0 {
+		return true, nil, nil
+	}
+	if userId == 0 {
+		return false, []int{}, nil
+	}
+
+	branchIds := make([]int, 0)
+	if err := db.WithContext(ctx).Model(&UserBranch{}).
+		Where("user_id = ?", userId).
+		Pluck("branch_id", &branchIds).Error; err != nil {
+		return false, nil, err
+	}
+	return false, branchIds, nil
+}
+
+// branch ids must exist and be within the caller's scope
+func ensureBranchesWithinScope(ctx context.Context, branchIds []int) error {
+	if len(branchIds) == 0 {
+		return nil
+	}
+	if err := utils.ValidateResourcesId[Branch](ctx, branchIds); err != nil {
+		return errors.New("branch not found")
+	}
+
+	scope := utils.GetBranchScopeFromContext(ctx)
+	if scope == nil {
+		return nil
+	}
+	all, allowed, err := scope.Resolve()
+	if err != nil {
+		return err
+	}
+	if all {
+		return nil
+	}
+	for _, branchId := range branchIds {
+		if !slices.Contains(allowed, branchId) {
+			return errors.New("branch is not assigned to you")
+		}
+	}
+	return nil
+}
+
+// only callers seeing every branch can hand out the bypass
+func ensureAllBranchesWithinScope(ctx context.Context) error {
+	scope := utils.GetBranchScopeFromContext(ctx)
+	if scope == nil {
+		return nil
+	}
+	all, _, err := scope.Resolve()
+	if err != nil {
+		return err
+	}
+	if !all {
+		return errors.New("all branches is not allowed for you")
+	}
+	return nil
+}
+
+// full replace of user's branch assignments
+func replaceUserBranches(ctx context.Context, tx *gorm.DB, userId int, branchIds []int) error {
+	if err := tx.WithContext(ctx).Where("user_id = ?", userId).Delete(&UserBranch{}).Error; err != nil {
+		return err
+	}
+	if len(branchIds) == 0 {
+		return nil
+	}
+
+	userBranches := make([]*UserBranch, 0, len(branchIds))
+	for _, branchId := range utils.UniqueSlice(branchIds) {
+		userBranches = append(userBranches, &UserBranch{UserId: userId, BranchId: branchId})
+	}
+	return tx.WithContext(ctx).Create(&userBranches).Error
+}
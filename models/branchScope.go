@@ -0,0 +1,77 @@
+package models
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// models with a branch_id column, only visible to users assigned to the branch
+type BranchScoped interface {
+	GetBranchId() int
+}
+
+func (p Product) GetBranchId() int {
+	return p.BranchId
+}
+
+// add branch_id IN (...) to queries, updates & deletes of BranchScoped models
+// made with a request context, see utils.BranchScope
+func RegisterBranchScope(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("branch_scope:query", applyBranchScope); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("branch_scope:update", applyBranchScope); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("branch_scope:delete", applyBranchScope); err != nil {
+		return err
+	}
+	return nil
+}
+
+func applyBranchScope(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	if _, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(BranchScoped); !ok {
+		return
+	}
+	scope := utils.GetBranchScopeFromContext(db.Statement.Context)
+	if scope == nil {
+		return
+	}
+	all, branchIds, err := scope.Resolve()
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	if all {
+		return
+	}
+
+	values := make([]interface{}, 0, len(branchIds))
+	for _, branchId := range branchIds {
+		values = append(values, branchId)
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: "branch_id"}, Values: values},
+	}})
+}
+
+// cached results are shared by every branch, check them against the caller's scope
+func inBranchScope(ctx context.Context, result interface{}) (bool, error) {
+	scoped, ok := result.(BranchScoped)
+	if !ok {
+		return true, nil
+	}
+	scope := utils.GetBranchScopeFromContext(ctx)
+	if scope == nil {
+		return true, nil
+	}
+	return scope.Allows(scoped.GetBranchId())
+}
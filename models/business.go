@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// tenant, every TenantScoped model belongs to one business
+type Business struct {
+	ID        string    `gorm:"primary_key;size:36" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name" binding:"required"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// create business with an Admin role allowed every module, modules must be synced
+func CreateBusiness(tx *gorm.DB, name string) (*Business, *Role, error) {
+
+	if strings.TrimSpace(name) == "" {
+		return nil, nil, errors.New("name is required")
+	}
+
+	var modules []Module
+	if err := tx.Find(&modules).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(modules) == 0 {
+		return nil, nil, errors.New("modules not found, run permissions:sync first")
+	}
+
+	business := Business{
+		ID:   uuid.NewString(),
+		Name: name,
+	}
+	if err := tx.Create(&business).Error; err != nil {
+		return nil, nil, err
+	}
+
+	role, err := CreateDefaultRole(tx, business.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// gives permission to owner
+	for _, module := range modules {
+		roleModule := RoleModule{
+			RoleId:         role.ID,
+			ModuleId:       module.ID,
+			AllowedActions: module.Actions,
+		}
+		if err := tx.Create(&roleModule).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &business, role, nil
+}
+
+// first user of a business, password policy is enforced
+func CreateBusinessAdmin(tx *gorm.DB, businessId string, roleId int, username string, email string, password string) (*User, error) {
+
+	if email != "" && !utils.IsValidEmail(email) {
+		return nil, errors.New("invalid email address")
+	}
+	policy := utils.GetPasswordPolicy()
+	if violations := policy.Check(password, username); len(violations) > 0 {
+		return nil, utils.NewPasswordPolicyError(violations)
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordChangedAt := time.Now()
+	user := User{
+		BusinessId:        businessId,
+		Username:          html.EscapeString(strings.TrimSpace(username)),
+		Name:              username,
+		Email:             strings.ToLower(email),
+		Password:          string(hashedPassword),
+		IsActive:          utils.NewTrue(),
+		RoleId:            roleId,
+		PasswordChangedAt: &passwordChangedAt,
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	if err := storePasswordHistory(context.Background(), tx, user.ID, user.Password, policy.HistoryCount); err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return &user, nil
+}
+
+// id of the only business, for logins that don't name one
+func getDefaultBusinessId(ctx context.Context, db *gorm.DB) (string, error) {
+	var businessIds []string
+	if err := db.WithContext(ctx).Model(&Business{}).Limit(2).Pluck("id", &businessIds).Error; err != nil {
+		return "", err
+	}
+	if len(businessIds) != 1 {
+		return "", errors.New("business id is required")
+	}
+	return businessIds[0], nil
+}
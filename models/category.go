@@ -3,6 +3,8 @@ package models
 import (
 	"context"
 	"errors"
+	"io"
+	"strconv"
 	"time"
 
 	"github.com/aungmyozaw92/go-graphql/config"
@@ -12,6 +14,7 @@ import (
 
 type Category struct {
 	ID               int       `gorm:"primary_key" json:"id"`
+	BusinessId       string    `gorm:"index;size:36;not null" json:"business_id"`
 	Name             string    `gorm:"index;size:100;not null" json:"name" binding:"required"`
 	ParentCategoryId int       `gorm:"index;not null" json:"parentCategoryId"`
 	IsActive         *bool     `gorm:"not null;default:true" json:"is_active"`
@@ -29,14 +32,62 @@ type CategoriesEdge Edge[Category]
 type CategoriesConnection struct {
 	PageInfo *PageInfo                `json:"pageInfo"`
 	Edges    []*CategoriesEdge 		  `json:"edges"`
+	TotalCounter
 }
 
-// node
-// returns decoded curosr string
-func (pc Category) GetCursor() string {
-	return pc.CreatedAt.String()
+// sortable fields of paginateCategory
+type CategoryOrderField string
+
+const (
+	CategoryOrderFieldName      CategoryOrderField = "NAME"
+	CategoryOrderFieldCreatedAt CategoryOrderField = "CREATED_AT"
+	CategoryOrderFieldUpdatedAt CategoryOrderField = "UPDATED_AT"
+)
+
+func (f CategoryOrderField) column() (string, bool) {
+	switch f {
+	case CategoryOrderFieldName:
+		return "name", true
+	case CategoryOrderFieldCreatedAt:
+		return "created_at", true
+	case CategoryOrderFieldUpdatedAt:
+		return "updated_at", true
+	}
+	return "", false
+}
+
+func (f CategoryOrderField) MarshalGQL(w io.Writer) {
+	w.Write([]byte(strconv.Quote(string(f))))
+}
+
+func (f *CategoryOrderField) UnmarshalGQL(i interface{}) error {
+	return unmarshalOrderField(i, f)
 }
 
+type CategoryOrder struct {
+	OrderBy[CategoryOrderField]
+}
+
+// filterable columns of Category, one line each
+type CategoryFilter struct {
+	Name             *StringFilter     `filter:"name"`
+	ParentCategoryId *IntFilter        `filter:"parent_category_id"`
+	IsActive         *BooleanFilter    `filter:"is_active"`
+	CreatedAt        *TimeFilter       `filter:"created_at"`
+	And              []*CategoryFilter
+	Or               []*CategoryFilter
+	Not              *CategoryFilter
+}
+
+// filter with the deprecated arguments of paginateCategory
+func CategoryFilterWithArgs(filter *CategoryFilter, name *string, parentCategoryId *int) *CategoryFilter {
+	return withArgsFilter(filter, &CategoryFilter{
+		Name:             containsFilter(name),
+		ParentCategoryId: idEqFilter(parentCategoryId),
+	})
+}
+
+
 // validate input for both create & update. (id = 0 for create)
 
 func (input *NewCategory) validate(ctx context.Context, id int) error {
@@ -77,7 +128,7 @@ func CreateCategory(ctx context.Context, input *NewCategory) (*Category, error)
 	}
 
 	// remove Cache for Category in Redis 
-	if err := utils.RemoveRedisList[Category](); err != nil {
+	if err := utils.InvalidateRedis[Category](ctx); err != nil {
 		return nil, err
 	}
 
@@ -109,7 +160,7 @@ func UpdateCategory(ctx context.Context, id int, input *NewCategory) (*Category,
 	}
 
 	// remove Cache for Module in Redis 
-	if err := RemoveRedisBoth(category); err != nil {
+	if err := utils.InvalidateRedis[Category](ctx, category.ID); err != nil {
 		return nil, err
 	}
 
@@ -142,7 +193,7 @@ func DeleteCategory(ctx context.Context, id int) (*Category, error) {
 	}
 
 	// remove Cache for Module in Redis 
-	if err := RemoveRedisBoth(category); err != nil {
+	if err := utils.InvalidateRedis[Category](ctx, category.ID); err != nil {
 		return nil, err
 	}
 
@@ -158,29 +209,34 @@ func ToggleActiveCategory(ctx context.Context, id int, isActive bool) (*Category
 	}
 
 	tx := db.Begin()
-	if err := tx.Model(&category).Updates(map[string]interface{}{
+	if err := tx.WithContext(ctx).Model(&category).Updates(map[string]interface{}{
 		"is_active": isActive,
 	}).Error; err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
-	if err := toggleChildrenCategories(ctx, tx, id, isActive); err != nil {
+	childrenIds, err := toggleChildrenCategories(ctx, tx, id, isActive)
+	if err != nil {
 		tx.Rollback()
 		return &category, err
 	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
 
-	// remove Cache for Module in Redis 
-	if err := RemoveRedisBoth(category); err != nil {
+	// remove Cache for Module in Redis, children have been toggled too
+	if err := utils.InvalidateRedis[Category](ctx, append(childrenIds, category.ID)...); err != nil {
 		return nil, err
 	}
 
-	return &category, tx.Commit().Error
+	return &category, nil
 }
 
 
 // toggle children of the parent recursively, parent is assumed to have toggled
-func toggleChildrenCategories(ctx context.Context, tx *gorm.DB, parentId int, isActive bool) error {
+// returns ids of every toggled descendant
+func toggleChildrenCategories(ctx context.Context, tx *gorm.DB, parentId int, isActive bool) ([]int, error) {
 	// get children ids
 	// toggle them
 	// toggle children of each child
@@ -192,29 +248,32 @@ func toggleChildrenCategories(ctx context.Context, tx *gorm.DB, parentId int, is
 		Where("parent_category_id = ?", parentId).
 		Select("id").
 		Scan(&childrenIds).Error; err != nil {
-		return err
+		return nil, err
 	}
 
 	// base case
 	// break when parent has no children
 	if len(childrenIds) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	if err := tx.WithContext(ctx).Model(&Category{}).
 		Where("id IN ?", childrenIds).Updates(map[string]interface{}{
 		"is_active": isActive,
 	}).Error; err != nil {
-		return err
+		return nil, err
 	}
 
+	toggledIds := childrenIds
 	for _, childId := range childrenIds {
 		// each child becomes a parent
-		if err := toggleChildrenCategories(ctx, tx, childId, isActive); err != nil {
-			return err
+		descendantIds, err := toggleChildrenCategories(ctx, tx, childId, isActive)
+		if err != nil {
+			return nil, err
 		}
+		toggledIds = append(toggledIds, descendantIds...)
 	}
-	return nil
+	return toggledIds, nil
 }
 
 
@@ -225,7 +284,7 @@ func GetCategory(ctx context.Context, id int) (*Category, error) {
 
 func GetCategories(ctx context.Context, name *string) ([]*Category, error) {
 
-	results, err := GetResources[Category](ctx, "name")
+	results, err := GetFilteredResources[Category](ctx, map[string]any{"name": name}, whereLike("name"), "name")
 
 	if err != nil {
 		return nil, err
@@ -234,26 +293,28 @@ func GetCategories(ctx context.Context, name *string) ([]*Category, error) {
 	return results, nil
 }
 
-func PaginateCategory(ctx context.Context, limit *int, after *string, name *string, parentCategoryId *int) (*CategoriesConnection, error) {
+func PaginateCategory(ctx context.Context, args PageArgs, orderBy []*CategoryOrder, filter *CategoryFilter) (*CategoriesConnection, error) {
 
 	db := config.GetDB()
 	dbCtx := db.WithContext(ctx)
 
-	
-	if name != nil && *name != "" {
-		dbCtx.Where("name LIKE ?", "%"+*name+"%")
-	}
-	if parentCategoryId != nil && *parentCategoryId > 0 {
-		dbCtx.Where("parent_category_id = ?", *parentCategoryId)
+	dbCtx, err := applyFilter(ctx, dbCtx, filter)
+	if err != nil {
+		return nil, err
 	}
 
-	edges, pageInfo, err := FetchPageCompositeCursor[Category](dbCtx, *limit, after, "created_at", "<")
+	orders, err := getPageOrders(ctx, orderBy, PageOrder{Column: "created_at", Desc: true})
+	if err != nil {
+		return nil, err
+	}
+	edges, pageInfo, counter, err := FetchPage[Category](dbCtx, args, orders...)
 
 	if err != nil {
 		return nil, err
 	}
 	var categoriesConnection CategoriesConnection
 	categoriesConnection.PageInfo = pageInfo
+	categoriesConnection.TotalCounter = counter
 	for _, edge := range edges {
 		categoryEdge := CategoriesEdge(edge)
 		categoriesConnection.Edges = append(categoriesConnection.Edges, &categoryEdge)
@@ -28,6 +28,14 @@ func (p Product) GetId() int {
 	return p.ID
 }
 
+func (role Role) GetId() int {
+	return role.ID
+}
+
+func (i Image) GetId() int {
+	return i.ID
+}
+
 // loader loading more than one model by one id
 type RelatedData interface {
 	GetReferenceId() int
@@ -5,38 +5,40 @@ import (
 
 	"github.com/aungmyozaw92/go-graphql/config"
 	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm"
 )
 
 // (may return RecordNotFound error)
 func GetResource[T any](ctx context.Context, id int, associations ...string) (*T, error) {
 
-	// find in redis
-	result, err := utils.GetRedis[T](id)
-	if err != nil {
-		return nil, err
-	}
-	// if not found in redis
-	if result == nil {
-		// fetch from db
+	// find in redis, on a miss one caller fetches from db while the rest wait
+	result, err := utils.LoadRedis(ctx, id, func(ctx context.Context) (*T, error) {
 		// result, err = utils.FetchModel[T](ctx, id, associations...)
 
 		db := config.GetDB()
-		dbCtx := db.WithContext(ctx)
+		// cache is shared by every branch, scope is checked below
+		dbCtx := db.WithContext(utils.WithoutBranchScope(ctx))
 		// preloading
 		for _, field := range associations {
 			dbCtx.Preload(field)
 		}
-		var result T
-		err := dbCtx.First(&result, id).Error
-		if err != nil {
+		var fetched T
+		if err := dbCtx.First(&fetched, id).Error; err != nil {
 			return nil, err
 		}
+		return &fetched, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// store in redis
-		if err := utils.StoreRedis[T](result, id); err != nil {
-			return nil, err
-		}
-	} 
+	allowed, err := inBranchScope(ctx, *result)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, gorm.ErrRecordNotFound
+	}
 
 	return result, nil
 }
@@ -44,30 +46,109 @@ func GetResource[T any](ctx context.Context, id int, associations ...string) (*T
 // list all resources, redis or db, cache result
 func GetResources[Model any](ctx context.Context, orders ...string) ([]*Model, error) {
 
-	// first try redis cache
-	results, err := utils.GetRedisList[Model]()
-	if err != nil {
-		return nil, err
-	}
-	// if not exists in redis
-	if results == nil {
-		// fetch from db
+	// first try redis cache, on a miss one caller fetches from db while the rest wait
+	results, err := utils.LoadRedisList(ctx, func(ctx context.Context) ([]*Model, error) {
 		db := config.GetDB()
 		var model Model
-		dbCtx := db.WithContext(ctx)
+		var results []*Model
+		// cache is shared by every branch, scope is applied below
+		dbCtx := db.WithContext(utils.WithoutBranchScope(ctx))
 		for _, order := range orders {
 			dbCtx.Order(order)
 		}
 		// db query
-		if err = dbCtx.Model(&model).Find(&results).Error; err != nil {
+		if err := dbCtx.Model(&model).Find(&results).Error; err != nil {
 			return nil, err
 		}
+		return results, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// caching the result
-		if err := utils.StoreRedisList[Model](results); err != nil {
+	return filterBranchScope(ctx, results)
+}
+
+// resources matching filters, cached per normalised filters until Model is invalidated
+// where applies the normalised filters, see utils.NormalizeFilters
+func GetFilteredResources[Model any](ctx context.Context, filters map[string]any, where func(dbCtx *gorm.DB, filters map[string]string) *gorm.DB, orders ...string) ([]*Model, error) {
+
+	normalized := utils.NormalizeFilters(filters)
+	results, err := utils.LoadRedisFilteredList(ctx, normalized, func(ctx context.Context) ([]*Model, error) {
+		db := config.GetDB()
+		var results []*Model
+		// cache is shared by every branch, scope is applied below
+		dbCtx := where(db.WithContext(utils.WithoutBranchScope(ctx)), normalized)
+		for _, order := range orders {
+			dbCtx = dbCtx.Order(order)
+		}
+		if err := dbCtx.Find(&results).Error; err != nil {
 			return nil, err
 		}
+		return results, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return filterBranchScope(ctx, results)
+}
+
+// where of GetFilteredResources, LIKE %value% for each of columns filtered
+func whereLike(columns ...string) func(dbCtx *gorm.DB, filters map[string]string) *gorm.DB {
+	return func(dbCtx *gorm.DB, filters map[string]string) *gorm.DB {
+		for _, column := range columns {
+			if value, ok := filters[column]; ok {
+				dbCtx = dbCtx.Where(column+" LIKE ?", "%"+value+"%")
+			}
+		}
+		return dbCtx
+	}
+}
+
+// results in ctx's branch scope
+func filterBranchScope[Model any](ctx context.Context, results []*Model) ([]*Model, error) {
+	scoped := make([]*Model, 0, len(results))
+	for _, result := range results {
+		allowed, err := inBranchScope(ctx, *result)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			scoped = append(scoped, result)
+		}
 	}
 
-	return results, nil
-}
\ No newline at end of file
+	return scoped, nil
+}
+// instances of ids from the cache, misses fetched in one query
+// ids not found or out of branch scope are left out
+func GetResourcesByIds[T Identifier](ctx context.Context, ids []int) ([]*T, error) {
+
+	results := make([]*T, 0, len(ids))
+	missingIds := make([]int, 0)
+	for _, id := range utils.UniqueSlice(ids) {
+		result, err := utils.GetRedis[T](ctx, id)
+		if err != nil || result == nil {
+			missingIds = append(missingIds, id)
+			continue
+		}
+		results = append(results, result)
+	}
+
+	if len(missingIds) > 0 {
+		db := config.GetDB()
+		var fetched []*T
+		// cache is shared by every branch, scope is applied below
+		if err := db.WithContext(utils.WithoutBranchScope(ctx)).Where("id IN ?", missingIds).Find(&fetched).Error; err != nil {
+			return nil, err
+		}
+		for _, result := range fetched {
+			// the cache is best effort
+			utils.StoreRedis[T](ctx, *result, (*result).GetId())
+			results = append(results, result)
+		}
+	}
+
+	return filterBranchScope(ctx, results)
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+)
+
+type FieldAccess string
+
+const (
+	FieldAccessVisible FieldAccess = "VISIBLE"
+	FieldAccessMasked  FieldAccess = "MASKED"
+	FieldAccessDenied  FieldAccess = "DENIED"
+)
+
+func (a FieldAccess) MarshalGQL(w io.Writer) {
+	w.Write([]byte(strconv.Quote(string(a))))
+}
+
+func (a *FieldAccess) UnmarshalGQL(i interface{}) error {
+	str, ok := i.(string)
+	if !ok {
+		return errors.New("field access must be string")
+	}
+
+	switch FieldAccess(str) {
+	case FieldAccessVisible, FieldAccessMasked, FieldAccessDenied:
+		*a = FieldAccess(str)
+	default:
+		return errors.New("invalid field access")
+	}
+	return nil
+}
+
+// higher is more restrictive
+func (a FieldAccess) rank() int {
+	switch a {
+	case FieldAccessMasked:
+		return 1
+	case FieldAccessDenied:
+		return 2
+	}
+	return 0
+}
+
+// per role rule for a graphql type's field, fields without a rule are visible
+type FieldPermission struct {
+	RoleId    int         `gorm:"primary_key;autoIncrement:false;not null" json:"role_id" binding:"required"`
+	TypeName  string      `gorm:"primary_key;size:100;not null" json:"type_name" binding:"required"`
+	FieldName string      `gorm:"primary_key;size:100;not null" json:"field_name" binding:"required"`
+	Access    FieldAccess `gorm:"size:20;not null;default:'VISIBLE'" json:"access" binding:"required"`
+	CreatedAt time.Time   `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time   `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type NewFieldPermission struct {
+	TypeName  string      `json:"typeName"`
+	FieldName string      `json:"fieldName"`
+	Access    FieldAccess `json:"access"`
+}
+
+// key of a field in field rule maps, e.g. Product.purchasePrice
+func FieldKey(typeName string, fieldName string) string {
+	return typeName + "." + fieldName
+}
+
+func mapFieldPermissions(input []*NewFieldPermission) ([]*FieldPermission, error) {
+
+	seen := make(map[string]bool, len(input))
+	var fieldPermissions []*FieldPermission
+	for _, rule := range input {
+		typeName := strings.TrimSpace(rule.TypeName)
+		fieldName := strings.TrimSpace(rule.FieldName)
+		if typeName == "" || fieldName == "" {
+			return nil, errors.New("type_name and field_name are required")
+		}
+		key := FieldKey(typeName, fieldName)
+		if seen[key] {
+			return nil, errors.New("duplicate field permission " + key)
+		}
+		seen[key] = true
+
+		fieldPermissions = append(fieldPermissions, &FieldPermission{
+			TypeName:  typeName,
+			FieldName: fieldName,
+			Access:    rule.Access,
+		})
+	}
+	return fieldPermissions, nil
+}
+
+func GetFieldPermissions(ctx context.Context, roleId int) ([]*FieldPermission, error) {
+
+	db := config.GetDB()
+	var results []*FieldPermission
+
+	if err := db.WithContext(ctx).Where("role_id = ?", roleId).
+		Order("type_name, field_name").Find(&results).Error; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// retrieve role's masked & denied fields from redis or db, keyed by FieldKey
+func GetFieldRulesFromRole(ctx context.Context, roleId int) (map[string]FieldAccess, error) {
+	key := "FieldPermissions:Role:" + fmt.Sprint(roleId)
+	var rules map[string]FieldAccess
+	exists, err := config.GetRedisObject(key, &rules)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return rules, nil
+	}
+
+	version := utils.GetPermissionsVersion()
+	fieldPermissions, err := GetFieldPermissions(ctx, roleId)
+	if err != nil {
+		return nil, err
+	}
+	rules = make(map[string]FieldAccess, 0)
+	for _, rule := range fieldPermissions {
+		if rule.Access != FieldAccessVisible {
+			rules[FieldKey(rule.TypeName, rule.FieldName)] = rule.Access
+		}
+	}
+
+	if err := utils.StorePermissionsCache(key, &rules, version); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// caller's masked & denied fields, keyed by FieldKey
+func getCallerFieldRules(ctx context.Context) (map[string]FieldAccess, error) {
+	roleIds, err := getCallerRoleIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return GetFieldRulesFromRoles(ctx, roleIds)
+}
+
+// graphql field of a column, e.g. sales_price is salesPrice
+func columnFieldName(column string) string {
+	parts := strings.Split(column, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// filtering or sorting by a field the caller can't see would reveal its values
+func ensureColumnVisible(rules map[string]FieldAccess, typeName string, column string) error {
+	field := FieldKey(typeName, columnFieldName(column))
+	if access, ok := rules[field]; ok && access != FieldAccessVisible {
+		return fmt.Errorf("field %s is %s", field, strings.ToLower(string(access)))
+	}
+	return nil
+}
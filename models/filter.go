@@ -0,0 +1,280 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// and/or/not nested deeper than this are refused
+const maxFilterDepth = 5
+
+// operators of a filterable column, all set ones must match
+// operators a graphql filter type doesn't declare stay nil
+type FieldFilter[V any] struct {
+	Eq     *V    `json:"eq,omitempty"`
+	Neq    *V    `json:"neq,omitempty"`
+	In     []V   `json:"in,omitempty"`
+	Gt     *V    `json:"gt,omitempty"`
+	Lt     *V    `json:"lt,omitempty"`
+	IsNull *bool `json:"isNull,omitempty"`
+}
+
+func (f FieldFilter[V]) expressions(column clause.Column) []clause.Expression {
+	exprs := make([]clause.Expression, 0)
+	if f.Eq != nil {
+		exprs = append(exprs, clause.Expr{SQL: "? = ?", Vars: []any{column, *f.Eq}})
+	}
+	if f.Neq != nil {
+		exprs = append(exprs, clause.Expr{SQL: "? <> ?", Vars: []any{column, *f.Neq}})
+	}
+	if f.In != nil {
+		if len(f.In) == 0 {
+			// matches nothing, IN of no values would bind NULL which NOT can't invert
+			exprs = append(exprs, clause.Expr{SQL: "1 = 0"})
+		} else {
+			exprs = append(exprs, clause.Expr{SQL: "? IN (?)", Vars: []any{column, f.In}})
+		}
+	}
+	if f.Gt != nil {
+		exprs = append(exprs, clause.Expr{SQL: "? > ?", Vars: []any{column, *f.Gt}})
+	}
+	if f.Lt != nil {
+		exprs = append(exprs, clause.Expr{SQL: "? < ?", Vars: []any{column, *f.Lt}})
+	}
+	if f.IsNull != nil {
+		if *f.IsNull {
+			exprs = append(exprs, clause.Expr{SQL: "? IS NULL", Vars: []any{column}})
+		} else {
+			exprs = append(exprs, clause.Expr{SQL: "? IS NOT NULL", Vars: []any{column}})
+		}
+	}
+	return exprs
+}
+
+type StringFilter struct {
+	FieldFilter[string]
+	Contains *string `json:"contains,omitempty"`
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (f StringFilter) expressions(column clause.Column) []clause.Expression {
+	exprs := f.FieldFilter.expressions(column)
+	if f.Contains != nil {
+		exprs = append(exprs, clause.Expr{SQL: "? LIKE ?", Vars: []any{column, "%" + likeEscaper.Replace(*f.Contains) + "%"}})
+	}
+	return exprs
+}
+
+type IntFilter struct {
+	FieldFilter[int]
+}
+
+type BooleanFilter struct {
+	FieldFilter[bool]
+}
+
+type TimeFilter struct {
+	FieldFilter[time.Time]
+}
+
+type DecimalFilter struct {
+	FieldFilter[decimal.Decimal]
+}
+
+type columnFilter interface {
+	expressions(column clause.Column) []clause.Expression
+}
+
+// joins exprs with AND or OR, nil when there are none
+func joinExpressions(exprs []clause.Expression, operator string) clause.Expression {
+	switch len(exprs) {
+	case 0:
+		return nil
+	case 1:
+		return exprs[0]
+	}
+	vars := make([]any, 0, len(exprs))
+	for _, expr := range exprs {
+		vars = append(vars, expr)
+	}
+	placeholders := strings.Repeat("? "+operator+" ", len(exprs)-1) + "?"
+	return clause.Expr{SQL: "(" + placeholders + ")", Vars: vars}
+}
+
+// conditions of a type's filter, a struct of column filters tagged with
+// their column, the tag being the allowlist, plus And, Or & Not of itself
+// e.g. Name *StringFilter `filter:"name"`
+// columns of fields masked or denied by rules are refused
+func filterExpression(filter reflect.Value, depth int, rules map[string]FieldAccess) (clause.Expression, error) {
+	if filter.IsNil() {
+		return nil, nil
+	}
+	if depth > maxFilterDepth {
+		return nil, errors.New("filter is nested too deeply")
+	}
+	filter = filter.Elem()
+	// UserFilter filters User
+	typeName := strings.TrimSuffix(filter.Type().Name(), "Filter")
+
+	exprs := make([]clause.Expression, 0)
+	for i := 0; i < filter.NumField(); i++ {
+		field := filter.Type().Field(i)
+		value := filter.Field(i)
+
+		if column, ok := field.Tag.Lookup("filter"); ok {
+			if value.IsNil() {
+				continue
+			}
+			if err := ensureColumnVisible(rules, typeName, column); err != nil {
+				return nil, err
+			}
+			f, ok := value.Interface().(columnFilter)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a column filter", field.Name)
+			}
+			exprs = append(exprs, f.expressions(clause.Column{Name: column})...)
+			continue
+		}
+
+		switch field.Name {
+		case "And", "Or":
+			nested := make([]clause.Expression, 0, value.Len())
+			for j := 0; j < value.Len(); j++ {
+				expr, err := filterExpression(value.Index(j), depth+1, rules)
+				if err != nil {
+					return nil, err
+				}
+				if expr != nil {
+					nested = append(nested, expr)
+				}
+			}
+			if expr := joinExpressions(nested, strings.ToUpper(field.Name)); expr != nil {
+				exprs = append(exprs, expr)
+			}
+		case "Not":
+			expr, err := filterExpression(value, depth+1, rules)
+			if err != nil {
+				return nil, err
+			}
+			if expr != nil {
+				exprs = append(exprs, clause.Expr{SQL: "NOT (?)", Vars: []any{expr}})
+			}
+		}
+	}
+	return joinExpressions(exprs, "AND"), nil
+}
+
+// conditions of the caller's filter
+func getFilterExpression[F any](ctx context.Context, filter *F) (clause.Expression, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	rules, err := getCallerFieldRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filterExpression(reflect.ValueOf(filter), 0, rules)
+}
+
+// dbCtx with filter's conditions
+func applyFilter[F any](ctx context.Context, dbCtx *gorm.DB, filter *F) (*gorm.DB, error) {
+	expr, err := getFilterExpression(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if expr != nil {
+		dbCtx = dbCtx.Where(expr)
+	}
+	return dbCtx, nil
+}
+
+// resources matching filter, cached per filter until Model is invalidated
+// scope, if any, is applied to the query too
+func GetResourcesByFilter[Model any, F any](ctx context.Context, filter *F, scope func(dbCtx *gorm.DB) *gorm.DB, orders ...string) ([]*Model, error) {
+
+	// checked before the cache, which is shared by callers seeing other fields
+	expr, err := getFilterExpression(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	filters := make(map[string]string)
+	if filter != nil {
+		b, err := json.Marshal(filter)
+		if err != nil {
+			return nil, err
+		}
+		filters["filter"] = string(b)
+	}
+
+	results, err := utils.LoadRedisFilteredList(ctx, filters, func(ctx context.Context) ([]*Model, error) {
+		db := config.GetDB()
+		var results []*Model
+		// cache is shared by every branch, scope is applied below
+		dbCtx := db.WithContext(utils.WithoutBranchScope(ctx))
+		if expr != nil {
+			dbCtx = dbCtx.Where(expr)
+		}
+		if scope != nil {
+			dbCtx = scope(dbCtx)
+		}
+		for _, order := range orders {
+			dbCtx = dbCtx.Order(order)
+		}
+		if err := dbCtx.Find(&results).Error; err != nil {
+			return nil, err
+		}
+		return results, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return filterBranchScope(ctx, results)
+}
+
+// deprecated positional string arguments, matched anywhere like before filter existed
+func containsFilter(value *string) *StringFilter {
+	if value == nil || *value == "" {
+		return nil
+	}
+	return &StringFilter{Contains: value}
+}
+
+func booleanEqFilter(value *bool) *BooleanFilter {
+	if value == nil {
+		return nil
+	}
+	return &BooleanFilter{FieldFilter[bool]{Eq: value}}
+}
+
+// ids of 0 meant no filter
+func idEqFilter(value *int) *IntFilter {
+	if value == nil || *value <= 0 {
+		return nil
+	}
+	return &IntFilter{FieldFilter[int]{Eq: value}}
+}
+
+// filter of the deprecated positional arguments in args, And filter
+// filter as is when none of them was given
+func withArgsFilter[F any](filter *F, args *F) *F {
+	if reflect.ValueOf(args).Elem().IsZero() {
+		return filter
+	}
+	if filter != nil {
+		reflect.ValueOf(args).Elem().FieldByName("And").Set(reflect.ValueOf([]*F{filter}))
+	}
+	return args
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func strPtr(s string) *string { return &s }
+
+func boolPtr(b bool) *bool { return &b }
+
+func intPtr(i int) *int { return &i }
+
+// WHERE clause of users matching filter, empty without one
+func userFilterWhere(t *testing.T, filter *UserFilter) string {
+	t.Helper()
+	expr, err := filterExpression(reflect.ValueOf(filter), 0, nil)
+	if err != nil {
+		t.Fatalf("filterExpression() error = %v", err)
+	}
+	sql := newDryRunDB(t).ToSQL(func(tx *gorm.DB) *gorm.DB {
+		if expr != nil {
+			tx = tx.Where(expr)
+		}
+		return tx.Find(&[]User{})
+	})
+	if _, where, found := strings.Cut(sql, " WHERE "); found {
+		return where
+	}
+	return ""
+}
+
+func TestFilterExpression(t *testing.T) {
+	if where := userFilterWhere(t, nil); where != "" {
+		t.Errorf("no filter = %s, want no WHERE", where)
+	}
+	if where := userFilterWhere(t, &UserFilter{}); where != "" {
+		t.Errorf("empty filter = %s, want no WHERE", where)
+	}
+
+	where := userFilterWhere(t, &UserFilter{RoleId: &IntFilter{FieldFilter[int]{Gt: intPtr(1), Lt: intPtr(5)}}})
+	if want := "(`role_id` > 1 AND `role_id` < 5)"; where != want {
+		t.Errorf("range = %s, want %s", where, want)
+	}
+
+	// % & _ of the value match themselves
+	where = userFilterWhere(t, &UserFilter{Name: &StringFilter{Contains: strPtr("50%_off")}})
+	if want := "`name` LIKE '%50\\%\\_off%'"; where != want {
+		t.Errorf("contains = %s, want %s", where, want)
+	}
+
+	where = userFilterWhere(t, &UserFilter{Username: &StringFilter{FieldFilter: FieldFilter[string]{In: []string{}}}})
+	if want := "1 = 0"; where != want {
+		t.Errorf("in of no values = %s, want %s", where, want)
+	}
+
+	where = userFilterWhere(t, &UserFilter{
+		IsActive: &BooleanFilter{FieldFilter[bool]{Eq: boolPtr(true)}},
+		Or: []*UserFilter{
+			{Name: &StringFilter{Contains: strPtr("ann")}},
+			{Username: &StringFilter{FieldFilter: FieldFilter[string]{In: []string{"a", "b"}}}},
+		},
+		Not: &UserFilter{Email: &StringFilter{FieldFilter: FieldFilter[string]{IsNull: boolPtr(true)}}},
+	})
+	want := "(`is_active` = true AND (`name` LIKE '%ann%' OR `username` IN ('a','b')) AND NOT (`email` IS NULL))"
+	if where != want {
+		t.Errorf("and, or & not = %s, want %s", where, want)
+	}
+}
+
+func TestFilterExpressionRefuses(t *testing.T) {
+	filter := &UserFilter{}
+	for i := 0; i <= maxFilterDepth; i++ {
+		filter = &UserFilter{Not: filter}
+	}
+	if _, err := filterExpression(reflect.ValueOf(filter), 0, nil); err == nil {
+		t.Error("filterExpression() nested too deeply succeeded")
+	}
+
+	rules := map[string]FieldAccess{"User.email": FieldAccessMasked, "User.phone": FieldAccessDenied}
+	filter = &UserFilter{Email: &StringFilter{Contains: strPtr("@example.com")}}
+	if _, err := filterExpression(reflect.ValueOf(filter), 0, rules); err == nil || err.Error() != "field User.email is masked" {
+		t.Errorf("filterExpression() on a masked field error = %v", err)
+	}
+	// hidden fields can't be reached through or either
+	filter = &UserFilter{Or: []*UserFilter{{Name: &StringFilter{Contains: strPtr("ann")}}, {Phone: &StringFilter{Contains: strPtr("09")}}}}
+	if _, err := filterExpression(reflect.ValueOf(filter), 0, rules); err == nil || err.Error() != "field User.phone is denied" {
+		t.Errorf("filterExpression() on a denied field error = %v", err)
+	}
+
+	filter = &UserFilter{Name: &StringFilter{Contains: strPtr("ann")}}
+	if _, err := filterExpression(reflect.ValueOf(filter), 0, rules); err != nil {
+		t.Errorf("filterExpression() on a visible field error = %v", err)
+	}
+}
+
+func TestUserFilterWithArgs(t *testing.T) {
+	// deprecated arguments are and-ed with filter, empty ones are ignored
+	filter := UserFilterWithArgs(&UserFilter{RoleId: &IntFilter{FieldFilter[int]{Eq: intPtr(2)}}}, strPtr("ann"), nil, nil, strPtr(""), boolPtr(false))
+	want := "(`name` LIKE '%ann%' AND `is_active` = false AND `role_id` = 2)"
+	if where := userFilterWhere(t, filter); where != want {
+		t.Errorf("UserFilterWithArgs() = %s, want %s", where, want)
+	}
+
+	filter = UserFilterWithArgs(nil, nil, strPtr("09"), nil, nil, nil)
+	if where := userFilterWhere(t, filter); where != "`phone` LIKE '%09%'" {
+		t.Errorf("UserFilterWithArgs() without filter = %s", where)
+	}
+}
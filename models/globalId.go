@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidGlobalId = errors.New("invalid global id")
+
+// opaque id of a node, unique across types, sent as base64 of "Type:id"
+type GlobalID struct {
+	Type string
+	ID   int
+}
+
+func NewGlobalID(typeName string, id int) GlobalID {
+	return GlobalID{Type: typeName, ID: id}
+}
+
+func (g GlobalID) String() string {
+	return base64.StdEncoding.EncodeToString([]byte(g.Type + ":" + strconv.Itoa(g.ID)))
+}
+
+func ParseGlobalID(s string) (GlobalID, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return GlobalID{}, ErrInvalidGlobalId
+	}
+	typeName, rawId, ok := strings.Cut(string(b), ":")
+	if !ok || typeName == "" {
+		return GlobalID{}, ErrInvalidGlobalId
+	}
+	id, err := strconv.Atoi(rawId)
+	if err != nil || id <= 0 {
+		return GlobalID{}, ErrInvalidGlobalId
+	}
+	return GlobalID{Type: typeName, ID: id}, nil
+}
+
+func (g GlobalID) MarshalGQL(w io.Writer) {
+	w.Write([]byte(strconv.Quote(g.String())))
+}
+
+func (g *GlobalID) UnmarshalGQL(i interface{}) error {
+	str, ok := i.(string)
+	if !ok {
+		return ErrInvalidGlobalId
+	}
+	id, err := ParseGlobalID(str)
+	if err != nil {
+		return err
+	}
+	*g = id
+	return nil
+}
+
+// object refetchable by its global id through node(id)
+type Node interface {
+	GetGlobalId() GlobalID
+}
+
+func (user User) GetGlobalId() GlobalID {
+	return NewGlobalID("User", user.ID)
+}
+
+func (role Role) GetGlobalId() GlobalID {
+	return NewGlobalID("Role", role.ID)
+}
+
+func (unit Unit) GetGlobalId() GlobalID {
+	return NewGlobalID("Unit", unit.ID)
+}
+
+func (category Category) GetGlobalId() GlobalID {
+	return NewGlobalID("Category", category.ID)
+}
+
+func (p Product) GetGlobalId() GlobalID {
+	return NewGlobalID("Product", p.ID)
+}
+
+func (i Image) GetGlobalId() GlobalID {
+	return NewGlobalID("Image", i.ID)
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestGlobalIDRoundTrip(t *testing.T) {
+	id := NewGlobalID("Product", 42)
+	got, err := ParseGlobalID(id.String())
+	if err != nil || got != id {
+		t.Errorf("ParseGlobalID(%s) = %+v, %v, want %+v", id, got, err, id)
+	}
+
+	var unmarshaled GlobalID
+	if err := unmarshaled.UnmarshalGQL(id.String()); err != nil || unmarshaled != id {
+		t.Errorf("UnmarshalGQL() = %+v, %v, want %+v", unmarshaled, err, id)
+	}
+	if err := unmarshaled.UnmarshalGQL(42); !errors.Is(err, ErrInvalidGlobalId) {
+		t.Errorf("UnmarshalGQL() of a number error = %v, want %v", err, ErrInvalidGlobalId)
+	}
+}
+
+func TestParseGlobalIDRefusesMalformedIds(t *testing.T) {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	for _, value := range []string{
+		"",
+		"Unit:12", // not base64
+		encode("Unit12"),
+		encode(":12"),
+		encode("Unit:"),
+		encode("Unit:0"),
+		encode("Unit:-1"),
+		encode("Unit:abc"),
+		encode("Unit:1:2"),
+	} {
+		if id, err := ParseGlobalID(value); !errors.Is(err, ErrInvalidGlobalId) {
+			t.Errorf("ParseGlobalID(%q) = %+v, %v, want %v", value, id, err, ErrInvalidGlobalId)
+		}
+	}
+}
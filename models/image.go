@@ -21,6 +21,7 @@ import (
 
 type Image struct {
 	ID            int    `gorm:"primary_key" json:"id"`
+	BusinessId    string `gorm:"index;size:36;not null" json:"business_id"`
 	ImageUrl      string `json:"image_url"`
 	ThumbnailUrl  string `json:"thumbnail_url"`
 	ReferenceType string `json:"reference_type"`
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+)
+
+// short lived token acting as the user, the caller stays the audited actor
+func ImpersonateUser(ctx context.Context, userId int, reason string) (*LoginInfo, error) {
+
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("reason is required")
+	}
+	if _, ok := utils.GetImpersonatorIdFromContext(ctx); ok {
+		return nil, errors.New("cannot impersonate while impersonating")
+	}
+	if apiKeyId, ok := utils.GetApiKeyIdFromContext(ctx); ok && apiKeyId > 0 {
+		return nil, errors.New("only users can impersonate")
+	}
+	callerId, ok := utils.GetUserIdFromContext(ctx)
+	if !ok || callerId == 0 {
+		return nil, errors.New("user id is required")
+	}
+	if callerId == userId {
+		return nil, errors.New("cannot impersonate yourself")
+	}
+
+	db := config.GetDB()
+	var caller, user User
+	if err := db.WithContext(ctx).First(&caller, callerId).Error; err != nil {
+		return nil, err
+	}
+	if err := db.WithContext(ctx).First(&user, userId).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	// the user can't be allowed anything the caller isn't
+	roleIds, err := GetActiveRoleIds(ctx, &user)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureRolesWithinCaller(ctx, roleIds); err != nil {
+		return nil, errors.New("cannot impersonate a user with more privileges than yours: " + err.Error())
+	}
+	var branchIds []int
+	if err := db.WithContext(ctx).Model(&UserBranch{}).Where("user_id = ?", userId).Pluck("branch_id", &branchIds).Error; err != nil {
+		return nil, err
+	}
+	if err := ensureBranchesWithinScope(ctx, branchIds); err != nil {
+		return nil, errors.New("cannot impersonate a user with more privileges than yours: " + err.Error())
+	}
+
+	return newLoginInfo(ctx, &user, &caller)
+}
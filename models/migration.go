@@ -10,14 +10,24 @@ func MigrateTable() {
 	db := config.GetDB()
 
 	err := db.AutoMigrate(
+		&Business{},
 		&User{},
+		&PasswordHistory{},
 		&Role{},
 		&Module{},
 		&RoleModule{},
+		&RoleParent{},
+		&UserRole{},
+		&AuditLog{},
+		&FieldPermission{},
 		&Unit{},
 		&Category{},
 		&Image{},
 		&Product{},
+		&Branch{},
+		&UserBranch{},
+		&ApiKey{},
+		&RevokedToken{},
 	)
 	if err != nil {
 		log.Fatal(err)
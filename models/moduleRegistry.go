@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm"
+)
+
+type ModuleAction string
+
+const (
+	ActionCreate       ModuleAction = "create"
+	ActionUpdate       ModuleAction = "update"
+	ActionDelete       ModuleAction = "delete"
+	ActionRead         ModuleAction = "read"
+	ActionToggleActive ModuleAction = "toggleActive"
+	ActionUpload       ModuleAction = "upload"
+	ActionRemove       ModuleAction = "remove"
+	ActionImpersonate  ModuleAction = "impersonate"
+)
+
+// module & the actions roles can be allowed, declared in code and synced to the modules table
+type ModuleDefinition struct {
+	Name    string
+	Actions []ModuleAction
+}
+
+var moduleRegistry = []ModuleDefinition{
+	{Name: "User", Actions: []ModuleAction{ActionCreate, ActionUpdate, ActionDelete, ActionRead, ActionImpersonate}},
+	{Name: "Role", Actions: []ModuleAction{ActionCreate, ActionUpdate, ActionDelete, ActionRead}},
+	{Name: "Module", Actions: []ModuleAction{ActionRead}},
+	{Name: "Unit", Actions: []ModuleAction{ActionCreate, ActionUpdate, ActionDelete, ActionRead, ActionToggleActive}},
+	{Name: "Category", Actions: []ModuleAction{ActionCreate, ActionUpdate, ActionDelete, ActionRead, ActionToggleActive}},
+	{Name: "Product", Actions: []ModuleAction{ActionCreate, ActionUpdate, ActionDelete, ActionRead, ActionToggleActive}},
+	{Name: "Image", Actions: []ModuleAction{ActionUpload, ActionRemove}},
+	{Name: "ApiKey", Actions: []ModuleAction{ActionCreate, ActionDelete, ActionRead}},
+	{Name: "Branch", Actions: []ModuleAction{ActionCreate, ActionUpdate, ActionDelete, ActionRead}},
+	{Name: "AuditLog", Actions: []ModuleAction{ActionRead}},
+}
+
+func RegisteredModules() []ModuleDefinition {
+	return moduleRegistry
+}
+
+// registered module by name, case insensitive
+func GetRegisteredModule(name string) (*ModuleDefinition, bool) {
+	for i := range moduleRegistry {
+		if strings.EqualFold(moduleRegistry[i].Name, name) {
+			return &moduleRegistry[i], true
+		}
+	}
+	return nil, false
+}
+
+// whether action is registered for module, case insensitive
+func IsRegisteredAction(module string, action string) bool {
+	definition, ok := GetRegisteredModule(module)
+	return ok && definition.HasAction(action)
+}
+
+func (definition ModuleDefinition) HasAction(action string) bool {
+	return slices.ContainsFunc(definition.Actions, func(a ModuleAction) bool {
+		return strings.EqualFold(string(a), action)
+	})
+}
+
+// actions in the modules table format, e.g. create;update
+func (definition ModuleDefinition) ActionsString() string {
+	actions := make([]string, 0, len(definition.Actions))
+	for _, action := range definition.Actions {
+		actions = append(actions, string(action))
+	}
+	return strings.Join(actions, ";")
+}
+
+// role module action no longer in the registry, still stored but granting nothing
+type OrphanModuleAction struct {
+	RoleId int
+	Module string
+	Action string
+}
+
+type ModuleSyncReport struct {
+	Created       []string
+	Updated       []string
+	OrphanModules []string
+	OrphanActions []OrphanModuleAction
+	// roles whose permissions changed, utils.ClearPermissionsCache them once the sync is committed
+	ChangedRoleIds []int
+}
+
+func (report *ModuleSyncReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "modules created: %v, updated: %v\n", report.Created, report.Updated)
+	for _, name := range report.OrphanModules {
+		fmt.Fprintf(&b, "orphaned module %s is not registered\n", name)
+	}
+	for _, orphan := range report.OrphanActions {
+		fmt.Fprintf(&b, "orphaned action %s of role %d is not registered\n", PermissionKey(orphan.Module, orphan.Action), orphan.RoleId)
+	}
+	return b.String()
+}
+
+// upsert registered modules into the modules table & report role module actions they no longer allow
+func SyncModules(tx *gorm.DB) (*ModuleSyncReport, error) {
+
+	// modules & role modules are shared by every business
+	ctx := utils.WithoutTenant(context.Background())
+	report := ModuleSyncReport{}
+
+	var modules []*Module
+	if err := tx.WithContext(ctx).Find(&modules).Error; err != nil {
+		return nil, err
+	}
+
+	changedRoleIds := make([]int, 0)
+	for _, definition := range moduleRegistry {
+		actions := definition.ActionsString()
+		index := slices.IndexFunc(modules, func(m *Module) bool { return m.Name == definition.Name })
+		if index < 0 {
+			module := Module{Name: definition.Name, Actions: actions}
+			if err := tx.WithContext(ctx).Create(&module).Error; err != nil {
+				return nil, err
+			}
+			report.Created = append(report.Created, definition.Name)
+			continue
+		}
+
+		module := modules[index]
+		if module.Actions == actions {
+			continue
+		}
+		if err := tx.WithContext(ctx).Model(module).Update("Actions", actions).Error; err != nil {
+			return nil, err
+		}
+		report.Updated = append(report.Updated, definition.Name)
+
+		// permissions of related roles have changed
+		roleIds, err := module.getRelatedRoleIds(ctx)
+		if err != nil {
+			return nil, err
+		}
+		changedRoleIds = append(changedRoleIds, roleIds...)
+	}
+	bumpedRoleIds, err := bumpPermissionVersion(ctx, tx, utils.UniqueSlice(changedRoleIds)...)
+	if err != nil {
+		return nil, err
+	}
+	report.ChangedRoleIds = bumpedRoleIds
+
+	for _, module := range modules {
+		if _, ok := GetRegisteredModule(module.Name); !ok {
+			report.OrphanModules = append(report.OrphanModules, module.Name)
+		}
+	}
+
+	var roleModules []*RoleModule
+	if err := tx.WithContext(ctx).Preload("Module").Order("role_id, module_id").Find(&roleModules).Error; err != nil {
+		return nil, err
+	}
+	for _, roleModule := range roleModules {
+		for _, action := range extractModuleActions(roleModule.AllowedActions) {
+			if action == "" || IsRegisteredAction(roleModule.Module.Name, action) {
+				continue
+			}
+			report.OrphanActions = append(report.OrphanActions, OrphanModuleAction{
+				RoleId: roleModule.RoleId,
+				Module: roleModule.Module.Name,
+				Action: action,
+			})
+		}
+	}
+
+	// remove Cache for Module in Redis, role permissions are tagged with Module too
+	moduleIds := make([]int, 0, len(modules))
+	for _, module := range modules {
+		moduleIds = append(moduleIds, module.ID)
+	}
+	if err := utils.InvalidateRedis[Module](ctx, moduleIds...); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm"
+)
+
+// map idp groups to a role, first configured match wins, then OIDC_DEFAULT_ROLE
+func mapOidcRole(ctx context.Context, groups []string, groupRoles [][2]string, defaultRole string) (*Role, error) {
+	roleName := ""
+	for _, mapping := range groupRoles {
+		for _, group := range groups {
+			if group == mapping[0] {
+				roleName = mapping[1]
+				break
+			}
+		}
+		if roleName != "" {
+			break
+		}
+	}
+	if roleName == "" {
+		roleName = defaultRole
+	}
+	if roleName == "" {
+		return nil, errors.New("no role is mapped for your groups")
+	}
+
+	var role Role
+	db := config.GetDB()
+	if err := db.WithContext(ctx).Where("name = ?", roleName).Take(&role).Error; err != nil {
+		return nil, fmt.Errorf("role %s not found", roleName)
+	}
+	return &role, nil
+}
+
+// pick a free username, based on preferred_username or email
+func uniqueOidcUsername(ctx context.Context, db *gorm.DB, identity *utils.OidcIdentity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	username := base
+	for i := 1; ; i++ {
+		var count int64
+		if err := db.WithContext(ctx).Model(&User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return username, nil
+		}
+		username = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// login with a verified oidc identity, provisioning the user just in time into businessId
+// (or the only business if empty)
+// a local account is never taken over by email, it has to be linked with LinkOidc first
+func LoginWithOidc(ctx context.Context, identity *utils.OidcIdentity, businessId string, groupRoles [][2]string, defaultRole string) (*LoginInfo, error) {
+
+	if businessId == "" {
+		defaultBusinessId, err := getDefaultBusinessId(ctx, config.GetDB())
+		if err != nil {
+			return nil, err
+		}
+		businessId = defaultBusinessId
+	}
+	// every lookup & the provisioned user are scoped to the business
+	ctx = utils.WithBusiness(ctx, businessId)
+
+	db := config.GetDB()
+	var user User
+	err := db.WithContext(ctx).
+		Where("oidc_issuer = ? AND oidc_subject = ?", identity.Issuer, identity.Subject).
+		Take(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// linked local account, its role stays as managed here
+	if err == nil && !user.OidcProvisioned {
+		return newLoginInfo(ctx, &user, nil)
+	}
+
+	role, err := mapOidcRole(ctx, identity.Groups, groupRoles, defaultRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		if identity.Email != "" {
+			var count int64
+			if err := db.WithContext(ctx).Model(&User{}).Where("email = ?", strings.ToLower(identity.Email)).Count(&count).Error; err != nil {
+				return nil, err
+			}
+			if count > 0 {
+				return nil, errors.New("an account with this email already exists, sign in and link it first")
+			}
+		}
+
+		username, err := uniqueOidcUsername(ctx, db, identity)
+		if err != nil {
+			return nil, err
+		}
+		// no local password, Login refuses provisioned users anyway
+		randomPassword, err := utils.UnusablePasswordHash()
+		if err != nil {
+			return nil, err
+		}
+		name := identity.Name
+		if name == "" {
+			name = username
+		}
+		user = User{
+			Username:        username,
+			Name:            name,
+			Email:           strings.ToLower(identity.Email),
+			Password:        string(randomPassword),
+			IsActive:        utils.NewTrue(),
+			RoleId:          role.ID,
+			OidcIssuer:      identity.Issuer,
+			OidcSubject:     identity.Subject,
+			OidcProvisioned: true,
+		}
+		if err := db.WithContext(ctx).Create(&user).Error; err != nil {
+			return nil, err
+		}
+		if err := utils.InvalidateRedis[User](ctx, user.ID); err != nil {
+			return nil, err
+		}
+		return newLoginInfo(ctx, &user, nil)
+	}
+
+	// idp is the source of truth for role & profile of the users it provisioned
+	updates := map[string]interface{}{
+		"RoleId": role.ID,
+	}
+	if identity.Name != "" {
+		updates["Name"] = identity.Name
+	}
+	if err := db.WithContext(ctx).Model(&user).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	if err := utils.InvalidateRedis[User](ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	return newLoginInfo(ctx, &user, nil)
+}
+
+// authorization url linking an idp identity to the signed in user, finished by the oidc callback
+func StartOidcLink(ctx context.Context) (string, error) {
+	userId, ok := utils.GetUserIdFromContext(ctx)
+	if !ok || userId == 0 {
+		return "", errors.New("user id is required")
+	}
+	if _, ok := utils.GetImpersonatorIdFromContext(ctx); ok {
+		return "", errors.New("cannot link an account while impersonating")
+	}
+	if _, ok := utils.GetApiKeyIdFromContext(ctx); ok {
+		return "", errors.New("cannot link an account with an api key")
+	}
+	businessId, ok := utils.GetBusinessIdFromContext(ctx)
+	if !ok {
+		return "", utils.ErrNoTenant
+	}
+
+	client, err := utils.GetOidcClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	return client.LinkCodeURL(userId, businessId)
+}
+
+// link identity to userId of businessId, as started by StartOidcLink
+// the account keeps its role, later oidc logins only sign it in
+func LinkOidc(ctx context.Context, identity *utils.OidcIdentity, userId int, businessId string) (*LoginInfo, error) {
+	ctx = utils.WithBusiness(ctx, businessId)
+
+	db := config.GetDB()
+	var user User
+	if err := db.WithContext(ctx).First(&user, userId).Error; err != nil {
+		return nil, err
+	}
+	if user.OidcIssuer == identity.Issuer && user.OidcSubject == identity.Subject {
+		return newLoginInfo(ctx, &user, nil)
+	}
+	if user.OidcSubject != "" {
+		return nil, errors.New("account is already linked to another identity")
+	}
+
+	var count int64
+	if err := db.WithContext(ctx).Model(&User{}).
+		Where("oidc_issuer = ? AND oidc_subject = ?", identity.Issuer, identity.Subject).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("identity is already linked to another account")
+	}
+
+	if err := db.WithContext(ctx).Model(&user).Updates(map[string]interface{}{
+		"OidcIssuer":  identity.Issuer,
+		"OidcSubject": identity.Subject,
+	}).Error; err != nil {
+		return nil, err
+	}
+	if err := utils.InvalidateRedis[User](ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return newLoginInfo(ctx, &user, nil)
+}
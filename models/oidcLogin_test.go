@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm"
+)
+
+var errUserCreated = errors.New("user created")
+
+// dry run database answering lookups of users with found & of roles with role,
+// the user LoginWithOidc creates is kept in created and the insert fails with errUserCreated
+func useOidcLoginDB(t *testing.T, found *User, role Role, created *User) {
+	t.Helper()
+	db := newDryRunDB(t)
+	db.Callback().Query().After("gorm:query").Register("test:rows", func(tx *gorm.DB) {
+		switch dest := tx.Statement.Dest.(type) {
+		case *User:
+			if found == nil {
+				tx.AddError(gorm.ErrRecordNotFound)
+			} else {
+				*dest = *found
+			}
+		case *Role:
+			*dest = role
+		}
+	})
+	db.Callback().Create().Before("gorm:create").Register("test:created", func(tx *gorm.DB) {
+		if user, ok := tx.Statement.Dest.(*User); ok {
+			*created = *user
+			tx.AddError(errUserCreated)
+		}
+	})
+	config.SetDB(db)
+	config.SetCache(config.NewMemoryCache(100))
+}
+
+func TestLoginWithOidcProvisionsNewUsers(t *testing.T) {
+	var created User
+	useOidcLoginDB(t, nil, Role{ID: 3, Name: "Cashier"}, &created)
+	identity := &utils.OidcIdentity{
+		// long enough that anything derived from them exceeds bcrypt's 72 bytes
+		Issuer:        "https://login.microsoftonline.com/7f3c2a8e-1b4d-4c6f-9e2a-5d8b0c1f3e7a/v2.0",
+		Subject:       "AAAAAAAAAAAAAAAAAAAAAJ1cY2Rzb21lLWxvbmctc3ViamVjdA",
+		Email:         "Jane@Example.com",
+		EmailVerified: true,
+		Name:          "Jane",
+		Username:      "jane",
+		Groups:        []string{"shop-cashiers"},
+	}
+
+	_, err := LoginWithOidc(context.Background(), identity, "business-1", [][2]string{{"shop-cashiers", "Cashier"}}, "")
+	if !errors.Is(err, errUserCreated) {
+		t.Fatalf("LoginWithOidc() error = %v, want the user created", err)
+	}
+
+	if !created.OidcProvisioned || created.OidcIssuer != identity.Issuer || created.OidcSubject != identity.Subject {
+		t.Errorf("created user isn't linked to the identity: %+v", created)
+	}
+	if created.Username != "jane" || created.Email != "jane@example.com" || created.RoleId != 3 {
+		t.Errorf("created user = %s %s role %d, want jane jane@example.com role 3", created.Username, created.Email, created.RoleId)
+	}
+	// a hash of nothing guessable
+	for _, guess := range []string{"", identity.Subject, identity.Issuer + identity.Subject} {
+		if utils.ComparePassword(created.Password, guess) == nil {
+			t.Errorf("password of the created user is %q", guess)
+		}
+	}
+}
+
+func TestLoginRefusesOidcProvisionedUsers(t *testing.T) {
+	hashed, err := utils.HashPassword("Secret123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provisioned := &User{ID: 7, Username: "jane", Password: string(hashed), IsActive: utils.NewTrue(), OidcProvisioned: true}
+	useOidcLoginDB(t, provisioned, Role{}, &User{})
+
+	businessId := "business-1"
+	if _, err := Login(context.Background(), "jane", "Secret123!", &businessId); err == nil || err.Error() != "invalid username or password" {
+		t.Errorf("Login() of a provisioned user error = %v", err)
+	}
+}
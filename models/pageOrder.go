@@ -0,0 +1,103 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type OrderDirection string
+
+const (
+	OrderDirectionAsc  OrderDirection = "ASC"
+	OrderDirectionDesc OrderDirection = "DESC"
+)
+
+func (d OrderDirection) MarshalGQL(w io.Writer) {
+	w.Write([]byte(strconv.Quote(string(d))))
+}
+
+func (d *OrderDirection) UnmarshalGQL(i interface{}) error {
+	str, ok := i.(string)
+	if !ok {
+		return errors.New("order direction must be string")
+	}
+
+	switch OrderDirection(str) {
+	case OrderDirectionAsc, OrderDirectionDesc:
+		*d = OrderDirection(str)
+	default:
+		return errors.New("invalid order direction")
+	}
+	return nil
+}
+
+// sortable field of a type, only the columns of its enum can reach sql
+type orderField interface {
+	~string
+	column() (string, bool)
+}
+
+func unmarshalOrderField[F orderField](i interface{}, f *F) error {
+	str, ok := i.(string)
+	if !ok {
+		return errors.New("order field must be string")
+	}
+	if _, ok := F(str).column(); !ok {
+		return errors.New("invalid order field")
+	}
+	*f = F(str)
+	return nil
+}
+
+// one entry of a paginate query's orderBy argument
+type OrderBy[F orderField] struct {
+	Field     F              `json:"field"`
+	Direction OrderDirection `json:"direction"`
+}
+
+func (o OrderBy[F]) pageOrder() (PageOrder, error) {
+	column, ok := o.Field.column()
+	if !ok {
+		return PageOrder{}, errors.New("invalid order field")
+	}
+	return PageOrder{Column: column, Desc: o.Direction == OrderDirectionDesc}, nil
+}
+
+type pageOrderer interface {
+	pageOrder() (PageOrder, error)
+}
+
+// page orders of orderBy, defaults when it's empty
+// fields masked or denied to the caller can't be sorted by
+func getPageOrders[O pageOrderer](ctx context.Context, orderBy []O, defaults ...PageOrder) ([]PageOrder, error) {
+	if len(orderBy) == 0 {
+		return defaults, nil
+	}
+	rules, err := getCallerFieldRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// UserOrder sorts User
+	orderType := reflect.TypeOf(orderBy).Elem()
+	if orderType.Kind() == reflect.Pointer {
+		orderType = orderType.Elem()
+	}
+	typeName := strings.TrimSuffix(orderType.Name(), "Order")
+
+	orders := make([]PageOrder, 0, len(orderBy))
+	for _, o := range orderBy {
+		order, err := o.pageOrder()
+		if err != nil {
+			return nil, err
+		}
+		if err := ensureColumnVisible(rules, typeName, order.Column); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
@@ -2,157 +2,208 @@ package models
 
 import (
 	"fmt"
+	"reflect"
+	"slices"
+	"strings"
 
-	"github.com/aungmyozaw92/go-graphql/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
-// new pagination combined struct embedding + generic struct
-type Cursor interface {
-	GetCursor() string
-}
-
-type Edge[N Cursor] struct {
+type Edge[N any] struct {
 	Node   *N
 	Cursor string
 }
 
+// column a page is ordered by, Desc puts the largest first
+type PageOrder struct {
+	Column string
+	Desc   bool
+}
 
-// fetch results for pagination
-func FetchPagePureCursor[T Cursor](dbCtx *gorm.DB,
-	limit int,
-	after *string,
-	cursorColumn string,
-	cmpOperator string,
-) ([]Edge[T], *PageInfo, error) {
-
-	nodes := make([]*T, 0)
-
-	// order
-	if cmpOperator == ">" {
-		dbCtx.Order(cursorColumn)
-	} else if cmpOperator == "<" {
-		dbCtx.Order(cursorColumn + " DESC")
-	}
+// total number of a connection's nodes, only counted when totalCount is selected
+type TotalCounter struct {
+	count func() (int64, error)
+}
 
-	// filter
-	decodedCursor, err := DecodeCursor(after)
-	if err != nil {
-		return nil, nil, err
-	}
-	if decodedCursor != "" {
-		dbCtx.Where(cursorColumn+" "+cmpOperator+" ?", decodedCursor)
+func (counter TotalCounter) TotalCount() (int, error) {
+	if counter.count == nil {
+		return 0, nil
 	}
+	count, err := counter.count()
+	return int(count), err
+}
 
-	// db query
-	dbCtx.Limit(limit + 1)
-	if err = dbCtx.Find(&nodes).Error; err != nil {
-		return nil, nil, err
-	}
+type pageKey struct {
+	field *schema.Field
+	desc  bool
+}
 
-	/*
-		constructing edges & page info
-	*/
-	count := 0
-	hasNextPage := false
-	edges := make([]Edge[T], 0, len(nodes))
-	for _, node := range nodes {
-		if count == limit {
-			hasNextPage = true
+// order columns of T, the primary key is added last so every row has its own cursor
+func getPageKeys(s *schema.Schema, orders []PageOrder) ([]pageKey, error) {
+	keys := make([]pageKey, 0, len(orders)+1)
+	for _, order := range orders {
+		field := s.LookUpField(order.Column)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("unknown order column %s", order.Column)
 		}
-		if count < limit {
-			var edge Edge[T]
-			edge.Node = node
-			edge.Cursor = EncodeCursor((*node).GetCursor())
-			edges = append(edges, edge)
-			count++
+		// a repeated column can't change the order
+		if slices.ContainsFunc(keys, func(key pageKey) bool { return key.field == field }) {
+			continue
 		}
+		keys = append(keys, pageKey{field: field, desc: order.Desc})
 	}
 
-	pageInfo := PageInfo{
-		StartCursor: "",
-		EndCursor:   "",
-		HasNextPage: utils.NewFalse(),
+	primary := s.PrioritizedPrimaryField
+	if primary == nil {
+		return nil, fmt.Errorf("%s has no primary key", s.Name)
 	}
-	if count > 0 {
-		pageInfo = PageInfo{
-			StartCursor: edges[0].Cursor,
-			EndCursor:   edges[count-1].Cursor,
-			HasNextPage: &hasNextPage,
-		}
+	if !slices.ContainsFunc(keys, func(key pageKey) bool { return key.field == primary }) {
+		desc := len(keys) > 0 && keys[len(keys)-1].desc
+		keys = append(keys, pageKey{field: primary, desc: desc})
 	}
-
-	return edges, &pageInfo, nil
+	return keys, nil
 }
 
-type CompositeCursor interface {
-	Cursor
-	Identifier
+// rows after values in the order of keys, or before them when backward
+// inclusive also matches the row of values itself
+func cursorCondition(keys []pageKey, values []any, backward bool, inclusive bool) (string, []any) {
+	conditions := make([]string, 0, len(keys))
+	args := make([]any, 0)
+	for i, key := range keys {
+		parts := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			parts = append(parts, keys[j].field.DBName+" = ?")
+			args = append(args, values[j])
+		}
+		operator := ">"
+		if key.desc != backward {
+			operator = "<"
+		}
+		if inclusive && i == len(keys)-1 {
+			operator += "="
+		}
+		parts = append(parts, key.field.DBName+" "+operator+" ?")
+		args = append(args, values[i])
+		conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+	}
+	return strings.Join(conditions, " OR "), args
 }
 
-// fetch results for pagination
-func FetchPageCompositeCursor[T CompositeCursor](dbCtx *gorm.DB,
-	limit int,
-	after *string,
-	cursorColumn string,
-	cmpOperator string,
-) ([]Edge[T], *PageInfo, error) {
+// whether any row of dbCtx is on the given side of values
+func existsBeyond[T any](dbCtx *gorm.DB, keys []pageKey, values []any, backward bool) (bool, error) {
+	condition, args := cursorCondition(keys, values, backward, true)
+	var ids []any
+	primary := keys[len(keys)-1].field.DBName
+	if err := dbCtx.Model(new(T)).Where(condition, args...).Limit(1).Pluck(primary, &ids).Error; err != nil {
+		return false, err
+	}
+	return len(ids) > 0, nil
+}
 
-	nodes := make([]*T, 0)
+// page of dbCtx's rows ordered by orders, following relay's connection spec
+// dbCtx should only hold the filters, they're reused to count the rows & to
+// check what's beyond the page
+func FetchPage[T any](dbCtx *gorm.DB, args PageArgs, orders ...PageOrder) ([]Edge[T], *PageInfo, TotalCounter, error) {
+	size, backward, err := args.size()
+	if err != nil {
+		return nil, nil, TotalCounter{}, err
+	}
 
-	// order
-	if cmpOperator == ">" {
-		dbCtx.Order(cursorColumn + ", id")
-	} else if cmpOperator == "<" {
-		dbCtx.Order(cursorColumn + " DESC, id DESC")
+	stmt := &gorm.Statement{DB: dbCtx}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, nil, TotalCounter{}, err
+	}
+	keys, err := getPageKeys(stmt.Schema, orders)
+	if err != nil {
+		return nil, nil, TotalCounter{}, err
+	}
+	columns := make([]string, 0, len(keys))
+	types := make([]reflect.Type, 0, len(keys))
+	for _, key := range keys {
+		columns = append(columns, key.field.DBName)
+		types = append(types, key.field.FieldType)
 	}
 
-	// filter
-	decodedCursor, cursorId := DecodeCompositeCursor(after)
-	if decodedCursor != "" {
-		dbCtx.Where(
-			// [1] = column, [2] = operator
-			fmt.Sprintf("%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?)", cursorColumn, cmpOperator),
-			decodedCursor, decodedCursor, cursorId)
+	// every query below starts from the filters only
+	dbCtx = dbCtx.Session(&gorm.Session{})
+	counter := TotalCounter{count: func() (int64, error) {
+		var count int64
+		err := dbCtx.Model(new(T)).Count(&count).Error
+		return count, err
+	}}
+
+	query := dbCtx
+	var afterValues, beforeValues []any
+	if args.After != nil {
+		if afterValues, err = decodeCursor(*args.After, columns, types); err != nil {
+			return nil, nil, TotalCounter{}, err
+		}
+		condition, conditionArgs := cursorCondition(keys, afterValues, false, false)
+		query = query.Where(condition, conditionArgs...)
+	}
+	if args.Before != nil {
+		if beforeValues, err = decodeCursor(*args.Before, columns, types); err != nil {
+			return nil, nil, TotalCounter{}, err
+		}
+		condition, conditionArgs := cursorCondition(keys, beforeValues, true, false)
+		query = query.Where(condition, conditionArgs...)
 	}
 
-	// db query
-	dbCtx.Limit(limit + 1)
-	if err := dbCtx.Find(&nodes).Error; err != nil {
-		return nil, nil, err
+	// last is read from the end, then put back in order
+	for _, key := range keys {
+		if key.desc != backward {
+			query = query.Order(key.field.DBName + " DESC")
+		} else {
+			query = query.Order(key.field.DBName)
+		}
+	}
+	nodes := make([]*T, 0)
+	if err := query.Limit(size + 1).Find(&nodes).Error; err != nil {
+		return nil, nil, TotalCounter{}, err
+	}
+	hasMore := len(nodes) > size
+	if hasMore {
+		nodes = nodes[:size]
+	}
+	if backward {
+		slices.Reverse(nodes)
 	}
 
-	/*
-		constructing edges & page info
-	*/
-	count := 0
-	hasNextPage := false
 	edges := make([]Edge[T], 0, len(nodes))
 	for _, node := range nodes {
-		if count == limit {
-			hasNextPage = true
+		values := make([]any, 0, len(keys))
+		for _, key := range keys {
+			value, _ := key.field.ValueOf(dbCtx.Statement.Context, reflect.ValueOf(node).Elem())
+			values = append(values, value)
 		}
-		if count < limit {
-			var edge Edge[T]
-			edge.Node = node
-			edge.Cursor = EncodeCompositeCursor((*node).GetCursor(), (*node).GetId())
-			edges = append(edges, edge)
-			count++
+		cursor, err := encodeCursor(columns, values)
+		if err != nil {
+			return nil, nil, TotalCounter{}, err
 		}
+		edges = append(edges, Edge[T]{Node: node, Cursor: cursor})
 	}
 
-	pageInfo := PageInfo{
-		StartCursor: "",
-		EndCursor:   "",
-		HasNextPage: utils.NewFalse(),
+	var pageInfo PageInfo
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
 	}
-	if count > 0 {
-		pageInfo = PageInfo{
-			StartCursor: edges[0].Cursor,
-			EndCursor:   edges[count-1].Cursor,
-			HasNextPage: &hasNextPage,
+	if backward {
+		pageInfo.HasPreviousPage = hasMore
+		if beforeValues != nil {
+			if pageInfo.HasNextPage, err = existsBeyond[T](dbCtx, keys, beforeValues, false); err != nil {
+				return nil, nil, TotalCounter{}, err
+			}
+		}
+	} else {
+		pageInfo.HasNextPage = hasMore
+		if afterValues != nil {
+			if pageInfo.HasPreviousPage, err = existsBeyond[T](dbCtx, keys, afterValues, true); err != nil {
+				return nil, nil, TotalCounter{}, err
+			}
 		}
 	}
 
-	return edges, &pageInfo, nil
-}
\ No newline at end of file
+	return edges, &pageInfo, counter, nil
+}
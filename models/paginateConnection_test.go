@@ -0,0 +1,76 @@
+package models
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/schema"
+)
+
+func unitPageKeys(t *testing.T, orders ...PageOrder) []pageKey {
+	t.Helper()
+	s, err := schema.Parse(&Unit{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := getPageKeys(s, orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestGetPageKeysEndWithPrimaryKey(t *testing.T) {
+	keys := unitPageKeys(t, PageOrder{Column: "name"}, PageOrder{Column: "name", Desc: true})
+	if len(keys) != 2 || keys[0].field.DBName != "name" || keys[0].desc || keys[1].field.DBName != "id" {
+		t.Errorf("getPageKeys() = %v, want name then id", keys)
+	}
+
+	// already ordered by the primary key
+	keys = unitPageKeys(t, PageOrder{Column: "id", Desc: true}, PageOrder{Column: "name"})
+	if len(keys) != 2 || keys[1].field.DBName != "name" {
+		t.Errorf("getPageKeys() = %v, want id then name", keys)
+	}
+
+	s, err := schema.Parse(&Unit{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getPageKeys(s, []PageOrder{{Column: "password"}}); err == nil {
+		t.Error("getPageKeys() of an unknown column succeeded")
+	}
+}
+
+func TestCursorCondition(t *testing.T) {
+	check := func(keys []pageKey, values []any, backward bool, inclusive bool, want string, wantArgs ...any) {
+		t.Helper()
+		got, args := cursorCondition(keys, values, backward, inclusive)
+		if got != want {
+			t.Errorf("cursorCondition() = %s, want %s", got, want)
+		}
+		if !reflect.DeepEqual(args, wantArgs) {
+			t.Errorf("cursorCondition() args = %v, want %v", args, wantArgs)
+		}
+	}
+
+	byId := unitPageKeys(t)
+	check(byId, []any{5}, false, false, "(id > ?)", 5)
+	check(byId, []any{5}, true, false, "(id < ?)", 5)
+
+	// ties on name are broken by id
+	byName := unitPageKeys(t, PageOrder{Column: "name"})
+	check(byName, []any{"kg", 5}, false, false, "(name > ?) OR (name = ? AND id > ?)", "kg", "kg", 5)
+
+	newest := unitPageKeys(t, PageOrder{Column: "created_at", Desc: true})
+	check(newest, []any{"2024-03-01", 5}, false, false,
+		"(created_at < ?) OR (created_at = ? AND id < ?)", "2024-03-01", "2024-03-01", 5)
+	check(newest, []any{"2024-03-01", 5}, true, false,
+		"(created_at > ?) OR (created_at = ? AND id > ?)", "2024-03-01", "2024-03-01", 5)
+
+	// inclusive also matches the row of the cursor
+	mixed := unitPageKeys(t, PageOrder{Column: "name"}, PageOrder{Column: "abbreviation", Desc: true})
+	check(mixed, []any{"kg", "k", 5}, false, true,
+		"(name > ?) OR (name = ? AND abbreviation < ?) OR (name = ? AND abbreviation = ? AND id <= ?)",
+		"kg", "kg", "k", "kg", "k", 5)
+}
@@ -2,59 +2,119 @@ package models
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"strconv"
-	"strings"
+	"reflect"
+	"slices"
+	"time"
 )
 
 type PageInfo struct {
-	StartCursor string `json:"startCursor"`
-	EndCursor   string `json:"endCursor"`
-	HasNextPage *bool  `json:"hasNextPage,omitempty"`
+	StartCursor     string `json:"startCursor"`
+	EndCursor       string `json:"endCursor"`
+	HasNextPage     bool   `json:"hasNextPage"`
+	HasPreviousPage bool   `json:"hasPreviousPage"`
 }
 
-
-func DecodeCursor(cursor *string) (string, error) {
-	decodedCursor := ""
-	if cursor != nil {
-		b, err := base64.StdEncoding.DecodeString(*cursor)
-		if err != nil {
-			return decodedCursor, err
-		}
-		decodedCursor = string(b)
-	}
-	return decodedCursor, nil
+// relay connection arguments, first/after page forward & last/before backward
+// Limit is the deprecated name of First
+type PageArgs struct {
+	First  *int
+	After  *string
+	Last   *int
+	Before *string
+	Limit  *int
 }
 
-func DecodeCompositeCursor(cursor *string) (string, int) {
-	if cursor == nil || *cursor == "" {
-		return "", 0
-	}
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
 
-	decoded, err := base64.StdEncoding.DecodeString(*cursor)
-	if err != nil {
-		return "", 0
+// number of edges to return & whether they are taken from the end
+func (args PageArgs) size() (int, bool, error) {
+	first := args.First
+	if first == nil {
+		first = args.Limit
 	}
-
-	parts := strings.Split(string(decoded), "|")
-	if len(parts) != 2 {
-		return "", 0
+	if first != nil && args.Last != nil {
+		return 0, false, errors.New("first and last can't be used together")
 	}
 
-	id, err := strconv.Atoi(parts[1])
-	if err != nil {
-		return "", 0
+	size, backward := defaultPageSize, false
+	if args.Last != nil {
+		size, backward = *args.Last, true
+	} else if first != nil {
+		size = *first
+	}
+	if size < 0 {
+		return 0, false, errors.New("page size must not be negative")
+	}
+	if size > maxPageSize {
+		return 0, false, fmt.Errorf("page size must not exceed %d", maxPageSize)
 	}
+	return size, backward, nil
+}
+
+// bumped whenever the layout changes, older cursors are rejected
+const cursorVersion = 1
+
+var ErrInvalidCursor = errors.New("invalid cursor")
 
-	return parts[0], id
+// values of the order columns of an edge's node, times are kept in UTC
+// so a cursor means the same row whatever the server's or db's time zone
+type pageCursor struct {
+	Version int               `json:"v"`
+	Columns []string          `json:"c"`
+	Values  []json.RawMessage `json:"k"`
 }
 
-func EncodeCursor(cursor string) string {
-	return base64.StdEncoding.EncodeToString([]byte(cursor))
-	// return cursor
+func encodeCursor(columns []string, values []any) (string, error) {
+	cursor := pageCursor{Version: cursorVersion, Columns: columns}
+	for _, value := range values {
+		switch t := value.(type) {
+		case time.Time:
+			value = t.UTC()
+		case *time.Time:
+			if t != nil {
+				value = t.UTC()
+			}
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		cursor.Values = append(cursor.Values, raw)
+	}
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-func EncodeCompositeCursor(transactionDateTime string, id int) string {
-	cursor := fmt.Sprintf("%s|%d", transactionDateTime, id)
-	return base64.StdEncoding.EncodeToString([]byte(cursor))
-}
\ No newline at end of file
+// values of cursor as types, it must have been made for the same columns
+func decodeCursor(encoded string, columns []string, types []reflect.Type) ([]any, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Version != cursorVersion || !slices.Equal(cursor.Columns, columns) || len(cursor.Values) != len(types) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]any, 0, len(types))
+	for i, raw := range cursor.Values {
+		value := reflect.New(types[i])
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values = append(values, value.Elem().Interface())
+	}
+	return values, nil
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var cursorColumns = []string{"created_at", "id"}
+
+var cursorTypes = []reflect.Type{reflect.TypeOf(time.Time{}), reflect.TypeOf(0)}
+
+func TestCursorRoundTrip(t *testing.T) {
+	yangon := time.FixedZone("Asia/Yangon", 6*60*60+30*60)
+	createdAt := time.Date(2024, 3, 1, 9, 30, 0, 0, yangon)
+
+	cursor, err := encodeCursor(cursorColumns, []any{createdAt, 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := decodeCursor(cursor, cursorColumns, cursorTypes)
+	if err != nil {
+		t.Fatalf("decodeCursor() error = %v", err)
+	}
+	// same instant whatever the zone of the server
+	if got := values[0].(time.Time); !got.Equal(createdAt) || got.Location() != time.UTC {
+		t.Errorf("decodeCursor() created_at = %v, want %v in UTC", got, createdAt)
+	}
+	if values[1] != 12 {
+		t.Errorf("decodeCursor() id = %v, want 12", values[1])
+	}
+}
+
+func TestDecodeCursorRefusesForeignCursors(t *testing.T) {
+	cursor, err := encodeCursor(cursorColumns, []any{time.Now(), 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	// made for another order
+	for _, columns := range [][]string{{"name", "id"}, {"id", "created_at"}} {
+		if _, err := decodeCursor(cursor, columns, cursorTypes); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor() for %v error = %v, want %v", columns, err, ErrInvalidCursor)
+		}
+	}
+
+	malformed := map[string]string{
+		"not base64":    "not a cursor!",
+		"not json":      encode("created_at,12"),
+		"other version": encode(`{"v":2,"c":["created_at","id"],"k":["2024-03-01T00:00:00Z",12]}`),
+		"fewer values":  encode(`{"v":1,"c":["created_at","id"],"k":[12]}`),
+		"wrong type":    encode(`{"v":1,"c":["created_at","id"],"k":["2024-03-01T00:00:00Z","12"]}`),
+	}
+	for name, cursor := range malformed {
+		if _, err := decodeCursor(cursor, cursorColumns, cursorTypes); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor() of %s error = %v, want %v", name, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestPageArgsSize(t *testing.T) {
+	number := func(i int) *int { return &i }
+
+	if size, backward, err := (PageArgs{}).size(); err != nil || size != defaultPageSize || backward {
+		t.Errorf("size() of no args = %d, %v, %v", size, backward, err)
+	}
+	// limit is the deprecated name of first
+	if size, backward, err := (PageArgs{Limit: number(7)}).size(); err != nil || size != 7 || backward {
+		t.Errorf("size() of limit = %d, %v, %v", size, backward, err)
+	}
+	if size, backward, err := (PageArgs{Last: number(3)}).size(); err != nil || size != 3 || !backward {
+		t.Errorf("size() of last = %d, %v, %v", size, backward, err)
+	}
+
+	for _, args := range []PageArgs{
+		{First: number(1), Last: number(1)},
+		{Limit: number(1), Last: number(1)},
+		{First: number(-1)},
+		{Last: number(maxPageSize + 1)},
+	} {
+		if _, _, err := args.size(); err == nil {
+			t.Errorf("size() of %+v succeeded", args)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm"
+)
+
+type PasswordHistory struct {
+	ID        int       `gorm:"primary_key" json:"id"`
+	UserId    int       `gorm:"index;not null" json:"user_id"`
+	Password  string    `gorm:"size:255;not null" json:"password"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// check the new password against last N hashes of the user
+func checkPasswordHistory(ctx context.Context, db *gorm.DB, userId int, newPassword string, count int) ([]utils.PasswordRuleViolation, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+
+	var histories []PasswordHistory
+	if err := db.WithContext(ctx).
+		Where("user_id = ?", userId).
+		Order("created_at DESC, id DESC").
+		Limit(count).
+		Find(&histories).Error; err != nil {
+		return nil, err
+	}
+
+	for _, history := range histories {
+		if err := utils.ComparePassword(history.Password, newPassword); err == nil {
+			return []utils.PasswordRuleViolation{{
+				Rule:    "history",
+				Message: "password was used recently",
+			}}, nil
+		}
+	}
+	return nil, nil
+}
+
+// store hashed password, remove histories older than last N
+func storePasswordHistory(ctx context.Context, tx *gorm.DB, userId int, hashedPassword string, count int) error {
+	if count <= 0 {
+		return nil
+	}
+
+	history := PasswordHistory{
+		UserId:   userId,
+		Password: hashedPassword,
+	}
+	if err := tx.WithContext(ctx).Create(&history).Error; err != nil {
+		return err
+	}
+
+	var keepIds []int
+	if err := tx.WithContext(ctx).Model(&PasswordHistory{}).
+		Where("user_id = ?", userId).
+		Order("created_at DESC, id DESC").
+		Limit(count).
+		Pluck("id", &keepIds).Error; err != nil {
+		return err
+	}
+
+	return tx.WithContext(ctx).
+		Where("user_id = ? AND id NOT IN ?", userId, keepIds).
+		Delete(&PasswordHistory{}).Error
+}
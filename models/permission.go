@@ -0,0 +1,114 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+)
+
+// module action allowed to the caller, Queries & Mutations are the graphql fields it unlocks
+type Permission struct {
+	Module    string   `json:"module"`
+	Action    string   `json:"action"`
+	Queries   []string `json:"queries"`
+	Mutations []string `json:"mutations"`
+}
+
+// roles allowed a module action, with their users
+type WhoCan struct {
+	Roles []*Role `json:"roles"`
+	Users []*User `json:"users"`
+}
+
+// caller's allowed module actions, ordered like the modules
+func GetMyPermissions(ctx context.Context) ([]*Permission, error) {
+
+	roleIds, err := getCallerRoleIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := GetPermissionsFromRoles(ctx, roleIds)
+	if err != nil {
+		return nil, err
+	}
+	modules, err := GetResources[Module](ctx, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Permission, 0)
+	for _, module := range modules {
+		for _, action := range strings.Split(module.Actions, ";") {
+			if permissions[PermissionKey(module.Name, action)] {
+				results = append(results, &Permission{
+					Module: module.Name,
+					Action: action,
+				})
+			}
+		}
+	}
+	return results, nil
+}
+
+func CanI(ctx context.Context, module string, action string) (bool, error) {
+
+	roleIds, err := getCallerRoleIds(ctx)
+	if err != nil {
+		return false, err
+	}
+	permissions, err := GetPermissionsFromRoles(ctx, roleIds)
+	if err != nil {
+		return false, err
+	}
+	return permissions[PermissionKey(module, action)], nil
+}
+
+// roles of the business allowed module action & users having those roles now
+func GetWhoCan(ctx context.Context, module string, action string) (*WhoCan, error) {
+
+	if module == "" || action == "" {
+		return nil, errors.New("module and action are required")
+	}
+	roles, err := GetResources[Role](ctx, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	result := WhoCan{
+		Roles: make([]*Role, 0),
+		Users: make([]*User, 0),
+	}
+	roleIds := make([]int, 0)
+	for _, role := range roles {
+		permissions, err := GetRolePermissions(ctx, role.ID)
+		if err != nil {
+			return nil, err
+		}
+		if permissions[PermissionKey(module, action)] {
+			result.Roles = append(result.Roles, role)
+			roleIds = append(roleIds, role.ID)
+		}
+	}
+	if len(roleIds) == 0 {
+		return &result, nil
+	}
+
+	db := config.GetDB()
+	now := time.Now()
+	activeGrants := db.Model(&UserRole{}).Select("user_id").
+		Where("role_id IN ?", roleIds).
+		Where("valid_from IS NULL OR valid_from <= ?", now).
+		Where("valid_until IS NULL OR valid_until > ?", now)
+	if err := db.WithContext(ctx).
+		Where("role_id IN ? OR id IN (?)", roleIds, activeGrants).
+		Order("username").Find(&result.Users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range result.Users {
+		user.PrepareGive()
+	}
+	return &result, nil
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"context"
 	"errors"
+	"io"
+	"strconv"
 	"time"
 
 	"github.com/aungmyozaw92/go-graphql/config"
@@ -14,6 +16,7 @@ import (
 type Product struct {
 	ID                  int               `gorm:"primary_key" json:"id"`
 	BusinessId          string            `gorm:"index;not null" json:"business_id" binding:"required"`
+	BranchId            int               `gorm:"index;not null;default:0" json:"branch_id" binding:"required"`
 	Name                string            `gorm:"size:100;not null" json:"name" binding:"required"`
 	Description         string            `gorm:"type:text" json:"description"`
 	CategoryId          int               `gorm:"index;not null;default:0" json:"category_id"`
@@ -32,6 +35,7 @@ type Product struct {
 
 type NewProduct struct {
 	Name                string                   `json:"name" binding:"required"`
+	BranchId            int                      `json:"branch_id" binding:"required"`
 	Description         string                   `json:"description"`
 	CategoryId          int                      `json:"category_id"`
 	Images              []*NewImage              `json:"image_urls"`
@@ -49,19 +53,82 @@ type ProductsEdge Edge[Product]
 type ProductsConnection struct {
 	PageInfo *PageInfo
 	Edges []*ProductsEdge
+	TotalCounter
 }
 
-// implements Node
-func (p Product) GetCursor() string {
-	return p.CreatedAt.String()
+// sortable fields of paginateProduct
+type ProductOrderField string
+
+const (
+	ProductOrderFieldName       ProductOrderField = "NAME"
+	ProductOrderFieldSku        ProductOrderField = "SKU"
+	ProductOrderFieldSalesPrice ProductOrderField = "SALES_PRICE"
+	ProductOrderFieldCreatedAt  ProductOrderField = "CREATED_AT"
+	ProductOrderFieldUpdatedAt  ProductOrderField = "UPDATED_AT"
+)
+
+func (f ProductOrderField) column() (string, bool) {
+	switch f {
+	case ProductOrderFieldName:
+		return "name", true
+	case ProductOrderFieldSku:
+		return "sku", true
+	case ProductOrderFieldSalesPrice:
+		return "sales_price", true
+	case ProductOrderFieldCreatedAt:
+		return "created_at", true
+	case ProductOrderFieldUpdatedAt:
+		return "updated_at", true
+	}
+	return "", false
+}
+
+func (f ProductOrderField) MarshalGQL(w io.Writer) {
+	w.Write([]byte(strconv.Quote(string(f))))
+}
+
+func (f *ProductOrderField) UnmarshalGQL(i interface{}) error {
+	return unmarshalOrderField(i, f)
+}
+
+type ProductOrder struct {
+	OrderBy[ProductOrderField]
 }
 
+// filterable columns of Product, one line each
+type ProductFilter struct {
+	Name       *StringFilter    `filter:"name"`
+	Sku        *StringFilter    `filter:"sku"`
+	Barcode    *StringFilter    `filter:"barcode"`
+	CategoryId *IntFilter       `filter:"category_id"`
+	UnitId     *IntFilter       `filter:"unit_id"`
+	SalesPrice *DecimalFilter   `filter:"sales_price"`
+	IsActive   *BooleanFilter   `filter:"is_active"`
+	CreatedAt  *TimeFilter      `filter:"created_at"`
+	And        []*ProductFilter
+	Or         []*ProductFilter
+	Not        *ProductFilter
+}
+
+// filter with the deprecated arguments of paginateProduct
+func ProductFilterWithArgs(filter *ProductFilter, name *string, sku *string) *ProductFilter {
+	return withArgsFilter(filter, &ProductFilter{
+		Name: containsFilter(name),
+		Sku:  containsFilter(sku),
+	})
+}
+
+
 // validate input for both create & update. (id = 0 for create)
 
 func (input *NewProduct) validate(ctx context.Context, id int) error {
 	if err := utils.ValidateUnique[Product](ctx, "name", input.Name, id); err != nil {
 		return err
 	}
+	// branch must be assigned to the user
+	if err := ensureBranchesWithinScope(ctx, []int{input.BranchId}); err != nil {
+		return err
+	}
 	// exists category
 	if input.CategoryId > 0 {
 		if err := utils.ValidateResourceId[Category](ctx, input.CategoryId); err != nil {
@@ -94,6 +161,7 @@ func CreateProduct(ctx context.Context, input *NewProduct) (*Product, error) {
 	// store product
 	product := Product{
 		Name:                input.Name,
+		BranchId:            input.BranchId,
 		Description:         input.Description,
 		CategoryId:          input.CategoryId,
 		UnitId:              input.UnitId,
@@ -122,9 +190,81 @@ func CreateProduct(ctx context.Context, input *NewProduct) (*Product, error) {
 		return nil, err
 	}
 
+	indexProducts(ctx, product.ID)
+
+	// remove Cache for Product in Redis
+	if err := utils.InvalidateRedis[Product](ctx); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+func UpdateProduct(ctx context.Context, id int, input *NewProduct) (*Product, error) {
+
+	if err := input.validate(ctx, id); err != nil {
+		return nil, err
+	}
+
+	var product Product
+
+	db := config.GetDB()
+	if err := db.WithContext(ctx).First(&product, id).Error; err != nil {
+		return nil, err
+	}
+
+	err := db.WithContext(ctx).Model(&product).Updates(map[string]interface{}{
+		"Name":            input.Name,
+		"BranchId":        input.BranchId,
+		"Description":     input.Description,
+		"CategoryId":      input.CategoryId,
+		"UnitId":          input.UnitId,
+		"SupplierId":      input.SupplierId,
+		"Sku":             input.Sku,
+		"Barcode":         input.Barcode,
+		"SalesPrice":      input.SalesPrice,
+		"PurchasePrice":   input.PurchasePrice,
+		"IsBatchTracking": input.IsBatchTracking,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	indexProducts(ctx, product.ID)
+
+	// remove Cache for Product in Redis
+	if err := utils.InvalidateRedis[Product](ctx, product.ID); err != nil {
+		return nil, err
+	}
+
 	return &product, nil
 }
 
+func ToggleActiveProduct(ctx context.Context, id int, isActive bool) (*Product, error) {
+
+	var product Product
+
+	db := config.GetDB()
+	if err := db.WithContext(ctx).First(&product, id).Error; err != nil {
+		return nil, err
+	}
+
+	err := db.WithContext(ctx).Model(&product).Updates(map[string]interface{}{
+		"IsActive": isActive,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	indexProducts(ctx, product.ID)
+
+	// remove Cache for Product in Redis
+	if err := utils.InvalidateRedis[Product](ctx, product.ID); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
 
 func DeleteProduct(ctx context.Context, id int) (*Product, error) {
 	
@@ -158,6 +298,13 @@ func DeleteProduct(ctx context.Context, id int) (*Product, error) {
 		return nil, err
 	}
 
+	indexProducts(ctx, result.ID)
+
+	// remove Cache for Product in Redis
+	if err := utils.InvalidateRedis[Product](ctx, result.ID); err != nil {
+		return nil, err
+	}
+
 	return &result, nil
 }
 
@@ -166,19 +313,37 @@ func GetProduct(ctx context.Context, id int) (*Product, error) {
 }
 
 func GetProducts(ctx context.Context, name *string) ([]*Product, error) {
-	db := config.GetDB()
-	var results []*Product
 
+	return GetFilteredResources[Product](ctx, map[string]any{"name": name}, whereLike("name"), "name")
+}
+
+
+func PaginateProduct(ctx context.Context, args PageArgs, orderBy []*ProductOrder, filter *ProductFilter) (*ProductsConnection, error) {
 
+	db := config.GetDB()
 	dbCtx := db.WithContext(ctx)
-	if name != nil && len(*name) > 0 {
-		dbCtx = dbCtx.Where("name LIKE ?", "%"+*name+"%")
+
+	dbCtx, err := applyFilter(ctx, dbCtx, filter)
+	if err != nil {
+		return nil, err
 	}
 
-	err := dbCtx.Order("name").
-		Find(&results).Error
+	orders, err := getPageOrders(ctx, orderBy, PageOrder{Column: "created_at", Desc: true})
+	if err != nil {
+		return nil, err
+	}
+	edges, pageInfo, counter, err := FetchPage[Product](dbCtx, args, orders...)
 	if err != nil {
 		return nil, err
 	}
-	return results, nil
-}
\ No newline at end of file
+
+	var productsConnection ProductsConnection
+	productsConnection.PageInfo = pageInfo
+	productsConnection.TotalCounter = counter
+
+	for _, edge := range edges {
+		productEdge := ProductsEdge(edge)
+		productsConnection.Edges = append(productsConnection.Edges, &productEdge)
+	}
+	return &productsConnection, nil
+}
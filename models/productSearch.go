@@ -0,0 +1,596 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/single"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const productIndexName = "products"
+
+// whole value, case insensitive, for skus & barcodes
+const codeAnalyzer = "code"
+
+const (
+	maxProductSearchSize = 100
+	productFacetSize     = 20
+)
+
+// upper bounds of the price band facet, the last band has none
+var productPriceBands = []float64{10, 50, 100, 500, 1000}
+
+type ProductSearchFilter struct {
+	CategoryIds []int            `json:"categoryIds"`
+	UnitIds     []int            `json:"unitIds"`
+	MinPrice    *decimal.Decimal `json:"minPrice"`
+	MaxPrice    *decimal.Decimal `json:"maxPrice"`
+	IsActive    *bool            `json:"isActive"`
+}
+
+type SearchHighlight struct {
+	Field     string   `json:"field"`
+	Fragments []string `json:"fragments"`
+}
+
+type SearchFacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type ProductSearchHit struct {
+	Product    *Product           `json:"product"`
+	Score      float64            `json:"score"`
+	Highlights []*SearchHighlight `json:"highlights"`
+}
+
+type ProductSearchFacets struct {
+	Categories []*SearchFacetCount `json:"categories"`
+	Units      []*SearchFacetCount `json:"units"`
+	PriceBands []*SearchFacetCount `json:"priceBands"`
+	// sales price is hidden from the caller, price bands would narrow it
+	priceBandsErr error
+}
+
+// price band counts, refused when the caller can't see sales prices
+func (facets *ProductSearchFacets) GetPriceBands() ([]*SearchFacetCount, error) {
+	if facets.priceBandsErr != nil {
+		return nil, facets.priceBandsErr
+	}
+	return facets.PriceBands, nil
+}
+
+type ProductSearchResult struct {
+	Total  int                  `json:"total"`
+	Hits   []*ProductSearchHit  `json:"hits"`
+	Facets *ProductSearchFacets `json:"facets"`
+}
+
+// indexed fields of a product, ids are keywords so they can be faceted
+type productDocument struct {
+	BusinessId  string  `json:"business_id"`
+	BranchId    string  `json:"branch_id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Sku         string  `json:"sku"`
+	Barcode     string  `json:"barcode"`
+	CategoryId  string  `json:"category_id"`
+	UnitId      string  `json:"unit_id"`
+	SalesPrice  float64 `json:"sales_price"`
+	IsActive    bool    `json:"is_active"`
+}
+
+func newProductDocument(product *Product) productDocument {
+	return productDocument{
+		BusinessId:  product.BusinessId,
+		BranchId:    strconv.Itoa(product.BranchId),
+		Name:        product.Name,
+		Description: product.Description,
+		Sku:         product.Sku,
+		Barcode:     product.Barcode,
+		CategoryId:  strconv.Itoa(product.CategoryId),
+		UnitId:      strconv.Itoa(product.UnitId),
+		SalesPrice:  product.SalesPrice.InexactFloat64(),
+		IsActive:    product.IsActive != nil && *product.IsActive,
+	}
+}
+
+// changes need search:reindex to apply to existing products
+func productIndexMapping() mapping.IndexMapping {
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.AddCustomAnalyzer(codeAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     single.Name,
+		"token_filters": []string{lowercase.Name},
+	})
+
+	text := bleve.NewTextFieldMapping()
+	text.Analyzer = standard.Name
+	// stored with term vectors for highlighting
+	text.Store = true
+	text.IncludeTermVectors = true
+
+	code := bleve.NewTextFieldMapping()
+	code.Analyzer = codeAnalyzer
+	code.Store = true
+	code.IncludeTermVectors = true
+
+	keyword := bleve.NewKeywordFieldMapping()
+	keyword.Store = false
+
+	numeric := bleve.NewNumericFieldMapping()
+	numeric.Store = false
+
+	boolean := bleve.NewBooleanFieldMapping()
+	boolean.Store = false
+
+	document := bleve.NewDocumentStaticMapping()
+	document.AddFieldMappingsAt("business_id", keyword)
+	document.AddFieldMappingsAt("branch_id", keyword)
+	document.AddFieldMappingsAt("name", text)
+	document.AddFieldMappingsAt("description", text)
+	document.AddFieldMappingsAt("sku", code)
+	document.AddFieldMappingsAt("barcode", code)
+	document.AddFieldMappingsAt("category_id", keyword)
+	document.AddFieldMappingsAt("unit_id", keyword)
+	document.AddFieldMappingsAt("sales_price", numeric)
+	document.AddFieldMappingsAt("is_active", boolean)
+	indexMapping.DefaultMapping = document
+
+	return indexMapping
+}
+
+func getProductIndex() (bleve.Index, error) {
+	return config.GetSearchIndex(productIndexName, productIndexMapping)
+}
+
+// products synced while the index is rebuilt, they may have been read before they changed
+// so they are synced again once the new index is swapped in
+var (
+	productReindexMu      sync.Mutex
+	productReindexChanged map[int]struct{}
+	// one rebuild at a time, each tracks its own changes
+	productRebuildMu sync.Mutex
+)
+
+// re-index products of ids after they were changed, deleted ones are removed
+// other replicas are told to do the same with their own index
+// the index is best effort, failures are logged & fixed by search:reindex
+func indexProducts(ctx context.Context, ids ...int) {
+	if err := syncProductIndex(ctx, ids...); err != nil {
+		config.GetLogger().WithField("error", err.Error()).Error("cannot index products")
+	}
+	if err := config.PublishSearchIndex(ctx, config.SearchIndexMessage{Index: productIndexName, Ids: idTerms(ids)}); err != nil {
+		config.GetLogger().WithField("error", err.Error()).Error("cannot publish product index changes")
+	}
+}
+
+func syncProductIndex(ctx context.Context, ids ...int) error {
+	productReindexMu.Lock()
+	if productReindexChanged != nil {
+		for _, id := range ids {
+			productReindexChanged[id] = struct{}{}
+		}
+	}
+	productReindexMu.Unlock()
+
+	index, err := getProductIndex()
+	if err != nil {
+		return err
+	}
+
+	var products []*Product
+	db := config.GetDB()
+	// the product may have moved to a branch the caller can't see
+	if err := db.WithContext(utils.WithoutBranchScope(ctx)).Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return err
+	}
+
+	batch := index.NewBatch()
+	for _, id := range ids {
+		batch.Delete(strconv.Itoa(id))
+	}
+	for _, product := range products {
+		if err := batch.Index(strconv.Itoa(product.ID), newProductDocument(product)); err != nil {
+			return err
+		}
+	}
+	return index.Batch(batch)
+}
+
+// rebuilds the product index from the database, returns the number of products indexed
+// searches keep using the current index until the new one is complete
+func ReindexProducts(ctx context.Context) (int, error) {
+	productRebuildMu.Lock()
+	defer productRebuildMu.Unlock()
+	ctx = utils.WithoutTenant(utils.WithoutBranchScope(ctx))
+
+	productReindexMu.Lock()
+	productReindexChanged = make(map[int]struct{})
+	productReindexMu.Unlock()
+
+	count := 0
+	db := config.GetDB()
+	err := config.RebuildSearchIndex(productIndexName, productIndexMapping, func(index bleve.Index) error {
+		var products []*Product
+		return db.WithContext(ctx).FindInBatches(&products, 500, func(tx *gorm.DB, _ int) error {
+			batch := index.NewBatch()
+			for _, product := range products {
+				if err := batch.Index(strconv.Itoa(product.ID), newProductDocument(product)); err != nil {
+					return err
+				}
+			}
+			if err := index.Batch(batch); err != nil {
+				return err
+			}
+			count += len(products)
+			return nil
+		}).Error
+	})
+
+	productReindexMu.Lock()
+	changed := make([]int, 0, len(productReindexChanged))
+	for id := range productReindexChanged {
+		changed = append(changed, id)
+	}
+	productReindexChanged = nil
+	productReindexMu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+	if len(changed) > 0 {
+		if err := syncProductIndex(ctx, changed...); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// asks every running replica to rebuild its product index from the database
+func RequestProductReindex(ctx context.Context) error {
+	return config.PublishSearchIndex(ctx, config.SearchIndexMessage{Index: productIndexName, Rebuild: true})
+}
+
+// applies other replicas' product changes & rebuild requests to this one's index,
+// blocks for the life of the process
+func SubscribeProductIndex(ctx context.Context) {
+	logger := config.GetLogger()
+	config.SubscribeSearchIndex(ctx, productIndexName, func(message config.SearchIndexMessage) {
+		if message.Rebuild {
+			// in the background, so changes keep being applied meanwhile
+			go func() {
+				if _, err := ReindexProducts(ctx); err != nil {
+					logger.WithField("error", err.Error()).Error("cannot rebuild product index")
+				}
+			}()
+			return
+		}
+		ids := make([]int, 0, len(message.Ids))
+		for _, id := range message.Ids {
+			if id, err := strconv.Atoi(id); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		if err := syncProductIndex(utils.WithoutTenant(ctx), ids...); err != nil {
+			logger.WithField("error", err.Error()).Error("cannot index products")
+		}
+	})
+}
+
+func termsQuery(field string, terms []string) query.Query {
+	queries := make([]query.Query, 0, len(terms))
+	for _, term := range terms {
+		q := bleve.NewTermQuery(term)
+		q.SetField(field)
+		queries = append(queries, q)
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+func idTerms(ids []int) []string {
+	terms := make([]string, 0, len(ids))
+	for _, id := range ids {
+		terms = append(terms, strconv.Itoa(id))
+	}
+	return terms
+}
+
+// text matches ranked by where they're found, exact codes first, then names
+// fields hidden from the caller by rules aren't matched, a match would reveal their values
+func productTextQuery(text string, rules map[string]FieldAccess) query.Query {
+	queries := make([]query.Query, 0)
+	if productFieldVisible(rules, "sku") {
+		sku := bleve.NewMatchQuery(text)
+		sku.SetField("sku")
+		sku.SetBoost(5)
+
+		skuPrefix := bleve.NewPrefixQuery(strings.ToLower(text))
+		skuPrefix.SetField("sku")
+		skuPrefix.SetBoost(2)
+		queries = append(queries, sku, skuPrefix)
+	}
+	if productFieldVisible(rules, "barcode") {
+		barcode := bleve.NewMatchQuery(text)
+		barcode.SetField("barcode")
+		barcode.SetBoost(5)
+		queries = append(queries, barcode)
+	}
+	if productFieldVisible(rules, "name") {
+		name := bleve.NewMatchQuery(text)
+		name.SetField("name")
+		name.SetBoost(3)
+
+		// tolerates typos
+		fuzzyName := bleve.NewMatchQuery(text)
+		fuzzyName.SetField("name")
+		fuzzyName.SetFuzziness(1)
+		queries = append(queries, name, fuzzyName)
+	}
+	if productFieldVisible(rules, "description") {
+		description := bleve.NewMatchQuery(text)
+		description.SetField("description")
+		queries = append(queries, description)
+	}
+	if len(queries) == 0 {
+		return bleve.NewMatchNoneQuery()
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+// whether the indexed field of column can be searched, highlighted or faceted by the caller
+func productFieldVisible(rules map[string]FieldAccess, column string) bool {
+	return ensureColumnVisible(rules, "Product", column) == nil
+}
+
+// restricts the query to ctx's business & branches, false when no branch is allowed
+func productScopeQueries(ctx context.Context) ([]query.Query, bool, error) {
+	queries := make([]query.Query, 0)
+	if businessId, ok := utils.GetBusinessIdFromContext(ctx); ok {
+		queries = append(queries, termsQuery("business_id", []string{businessId}))
+	} else if !utils.IsWithoutTenant(ctx) {
+		return nil, false, utils.ErrNoTenant
+	}
+	if scope := utils.GetBranchScopeFromContext(ctx); scope != nil {
+		all, branchIds, err := scope.Resolve()
+		if err != nil {
+			return nil, false, err
+		}
+		if !all {
+			if len(branchIds) == 0 {
+				return nil, false, nil
+			}
+			queries = append(queries, termsQuery("branch_id", idTerms(branchIds)))
+		}
+	}
+	return queries, true, nil
+}
+
+func (filter *ProductSearchFilter) queries(rules map[string]FieldAccess) ([]query.Query, error) {
+	queries := make([]query.Query, 0)
+	if filter == nil {
+		return queries, nil
+	}
+	if len(filter.CategoryIds) > 0 {
+		queries = append(queries, termsQuery("category_id", idTerms(filter.CategoryIds)))
+	}
+	if len(filter.UnitIds) > 0 {
+		queries = append(queries, termsQuery("unit_id", idTerms(filter.UnitIds)))
+	}
+	if filter.MinPrice != nil || filter.MaxPrice != nil {
+		if err := ensureColumnVisible(rules, "Product", "sales_price"); err != nil {
+			return nil, err
+		}
+		var min, max *float64
+		if filter.MinPrice != nil {
+			value := filter.MinPrice.InexactFloat64()
+			min = &value
+		}
+		if filter.MaxPrice != nil {
+			value := filter.MaxPrice.InexactFloat64()
+			max = &value
+		}
+		inclusive := true
+		price := bleve.NewNumericRangeInclusiveQuery(min, max, &inclusive, &inclusive)
+		price.SetField("sales_price")
+		queries = append(queries, price)
+	}
+	if filter.IsActive != nil {
+		active := bleve.NewBoolFieldQuery(*filter.IsActive)
+		active.SetField("is_active")
+		queries = append(queries, active)
+	}
+	return queries, nil
+}
+
+// price bands only when the caller can see sales prices
+func addProductFacets(request *bleve.SearchRequest, rules map[string]FieldAccess) {
+	request.AddFacet("categories", bleve.NewFacetRequest("category_id", productFacetSize))
+	request.AddFacet("units", bleve.NewFacetRequest("unit_id", productFacetSize))
+	if !productFieldVisible(rules, "sales_price") {
+		return
+	}
+
+	priceBands := bleve.NewFacetRequest("sales_price", len(productPriceBands)+1)
+	var min *float64
+	for i := range productPriceBands {
+		max := &productPriceBands[i]
+		priceBands.AddNumericRange(priceBandName(min, max), min, max)
+		min = max
+	}
+	priceBands.AddNumericRange(priceBandName(min, nil), min, nil)
+	request.AddFacet("priceBands", priceBands)
+}
+
+// e.g. 10-50, 1000+
+func priceBandName(min *float64, max *float64) string {
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	if min == nil {
+		return "0-" + format(*max)
+	}
+	if max == nil {
+		return format(*min) + "+"
+	}
+	return format(*min) + "-" + format(*max)
+}
+
+func facetCounts(result *bleve.SearchResult, name string) []*SearchFacetCount {
+	counts := make([]*SearchFacetCount, 0)
+	facet, ok := result.Facets[name]
+	if !ok {
+		return counts
+	}
+	for _, term := range facet.Terms.Terms() {
+		counts = append(counts, &SearchFacetCount{Value: term.Term, Count: term.Count})
+	}
+	// in band order, empty bands included
+	if len(facet.NumericRanges) > 0 {
+		bands := make(map[string]int, len(facet.NumericRanges))
+		for _, band := range facet.NumericRanges {
+			bands[band.Name] = band.Count
+		}
+		var min *float64
+		for i := 0; i <= len(productPriceBands); i++ {
+			var max *float64
+			if i < len(productPriceBands) {
+				max = &productPriceBands[i]
+			}
+			name := priceBandName(min, max)
+			counts = append(counts, &SearchFacetCount{Value: name, Count: bands[name]})
+			min = max
+		}
+	}
+	return counts
+}
+
+// products of ctx's business & branches matching text, best first
+// an empty text matches every product, e.g. to browse by facets
+func SearchProducts(ctx context.Context, text string, filter *ProductSearchFilter, first int, offset int) (*ProductSearchResult, error) {
+
+	if first < 0 || first > maxProductSearchSize {
+		return nil, errors.New("first must be between 0 and " + strconv.Itoa(maxProductSearchSize))
+	}
+	if offset < 0 {
+		return nil, errors.New("offset must not be negative")
+	}
+
+	result := &ProductSearchResult{
+		Hits: make([]*ProductSearchHit, 0),
+		Facets: &ProductSearchFacets{
+			Categories: make([]*SearchFacetCount, 0),
+			Units:      make([]*SearchFacetCount, 0),
+			PriceBands: make([]*SearchFacetCount, 0),
+		},
+	}
+
+	// hidden fields can't be matched, highlighted, filtered or faceted
+	rules, err := getCallerFieldRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result.Facets.priceBandsErr = ensureColumnVisible(rules, "Product", "sales_price")
+	filterQueries, err := filter.queries(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	queries, allowed, err := productScopeQueries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return result, nil
+	}
+	if text = strings.TrimSpace(text); text != "" {
+		queries = append(queries, productTextQuery(text, rules))
+	} else {
+		queries = append(queries, bleve.NewMatchAllQuery())
+	}
+	queries = append(queries, filterQueries...)
+
+	request := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(queries...), first, offset, false)
+	request.Highlight = bleve.NewHighlightWithStyle(html.Name)
+	for _, column := range []string{"name", "description", "sku"} {
+		if productFieldVisible(rules, column) {
+			request.Highlight.AddField(column)
+		}
+	}
+	addProductFacets(request, rules)
+
+	index, err := getProductIndex()
+	if err != nil {
+		return nil, err
+	}
+	searchResult, err := index.SearchInContext(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(searchResult.Hits))
+	for _, hit := range searchResult.Hits {
+		if id, err := strconv.Atoi(hit.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	products, err := GetResourcesByIds[Product](ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	productsById := make(map[int]*Product, len(products))
+	for _, product := range products {
+		productsById[product.ID] = product
+	}
+
+	for _, hit := range searchResult.Hits {
+		id, _ := strconv.Atoi(hit.ID)
+		product, ok := productsById[id]
+		// deleted since it was indexed
+		if !ok {
+			continue
+		}
+		highlights := make([]*SearchHighlight, 0, len(hit.Fragments))
+		for field, fragments := range hit.Fragments {
+			// stored fields come back whole even when they didn't match
+			matched := make([]string, 0, len(fragments))
+			for _, fragment := range fragments {
+				if strings.Contains(fragment, "<mark>") {
+					matched = append(matched, fragment)
+				}
+			}
+			if len(matched) > 0 {
+				highlights = append(highlights, &SearchHighlight{Field: field, Fragments: matched})
+			}
+		}
+		sort.Slice(highlights, func(i, j int) bool {
+			return highlights[i].Field < highlights[j].Field
+		})
+		result.Hits = append(result.Hits, &ProductSearchHit{
+			Product:    product,
+			Score:      hit.Score,
+			Highlights: highlights,
+		})
+	}
+
+	result.Total = int(searchResult.Total)
+	result.Facets.Categories = facetCounts(searchResult, "categories")
+	result.Facets.Units = facetCounts(searchResult, "units")
+	result.Facets.PriceBands = facetCounts(searchResult, "priceBands")
+	return result, nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/shopspring/decimal"
+)
+
+func TestProductSearchRespectsFieldRules(t *testing.T) {
+	rules := map[string]FieldAccess{"Product.salesPrice": FieldAccessMasked, "Product.description": FieldAccessDenied}
+
+	min := decimal.NewFromInt(10)
+	filter := &ProductSearchFilter{MinPrice: &min}
+	if _, err := filter.queries(rules); err == nil || err.Error() != "field Product.salesPrice is masked" {
+		t.Errorf("queries() on a masked price error = %v", err)
+	}
+	if queries, err := filter.queries(nil); err != nil || len(queries) != 1 {
+		t.Errorf("queries() without rules = %d queries, %v", len(queries), err)
+	}
+
+	request := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	addProductFacets(request, rules)
+	if _, ok := request.Facets["priceBands"]; ok {
+		t.Error("price bands faceted with a masked price")
+	}
+	facets := &ProductSearchFacets{priceBandsErr: ensureColumnVisible(rules, "Product", "sales_price")}
+	if _, err := facets.GetPriceBands(); err == nil {
+		t.Error("GetPriceBands() with a masked price succeeded")
+	}
+
+	text := productTextQuery("tea", rules).(*query.DisjunctionQuery)
+	for _, q := range text.Disjuncts {
+		if field, ok := q.(query.FieldableQuery); ok && strings.EqualFold(field.Field(), "description") {
+			t.Error("text query matches the denied description")
+		}
+	}
+	all := map[string]FieldAccess{"Product.sku": FieldAccessDenied, "Product.barcode": FieldAccessDenied, "Product.name": FieldAccessDenied, "Product.description": FieldAccessDenied}
+	if _, ok := productTextQuery("tea", all).(*query.MatchNoneQuery); !ok {
+		t.Error("text query with every field hidden matches")
+	}
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm/clause"
+)
+
+// jti of a revoked token, kept until the token expires
+// the cache holds the same revocations, this is what's checked while it's unavailable
+type RevokedToken struct {
+	Jti       string    `gorm:"primary_key;size:64" json:"jti"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// blacklist token by jti until it expires, in the database & the cache
+func RevokeToken(ctx context.Context, claim *utils.JwtCustomClaim) error {
+	lifespan := utils.GetTokenRevocationLifespan(claim)
+	if lifespan <= 0 {
+		return nil
+	}
+
+	db := config.GetDB()
+	revoked := RevokedToken{Jti: claim.ID, ExpiresAt: time.Now().Add(lifespan)}
+	if err := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+		return err
+	}
+	// revocations of expired tokens are of no use
+	if err := db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&RevokedToken{}).Error; err != nil {
+		return err
+	}
+
+	// the database has it while the cache is down
+	if err := utils.RevokeToken(claim); err != nil && !errors.Is(err, config.ErrCacheUnavailable) {
+		return err
+	}
+	return nil
+}
+
+// revoked tokens are found in the cache, the database is checked on a miss, while it's unavailable
+// and for impersonation tokens, which must never outlive their revocation
+// fails closed, an error means the token can't be trusted
+func IsTokenRevoked(ctx context.Context, claim *utils.JwtCustomClaim) (bool, error) {
+	revoked, known, err := utils.IsTokenRevoked(claim.ID)
+	if err != nil && !errors.Is(err, config.ErrCacheUnavailable) {
+		return false, err
+	}
+	// the cache loses keys on eviction, restart or flush, a miss isn't valid
+	if known && (revoked || claim.ImpersonatorId == 0) {
+		return revoked, nil
+	}
+
+	var count int64
+	db := config.GetDB()
+	if err := db.WithContext(ctx).Model(&RevokedToken{}).Where("jti = ?", claim.ID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		err = utils.RevokeToken(claim)
+	} else {
+		err = utils.SetTokenNotRevoked(claim.ID)
+	}
+	if err != nil && !errors.Is(err, config.ErrCacheUnavailable) {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"context"
 	"errors"
+	"fmt"
 	"slices"
 	"strings"
 	"time"
@@ -14,8 +15,13 @@ import (
 
 type Role struct {
 	ID          int           `gorm:"primary_key" json:"id"`
+	BusinessId  string        `gorm:"index;size:36;not null" json:"business_id"`
 	Name        string        `gorm:"index;size:100;not null" json:"name" binding:"required"`
 	RoleModules []*RoleModule `gorm:"foreignKey:RoleId"`
+	FieldPermissions []*FieldPermission `gorm:"foreignKey:RoleId" json:"field_permissions"`
+	RoleParents []*RoleParent     `gorm:"foreignKey:RoleId" json:"role_parents"`
+	PermissionVersion int     `gorm:"not null;default:1" json:"permission_version"`
+	AllBranches *bool         `gorm:"not null;default:false" json:"all_branches"` // bypass branch scoping
 	CreatedAt   time.Time     `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt   time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -23,6 +29,9 @@ type Role struct {
 type NewRole struct {
 	Name           string              `json:"name" binding:"required"`
 	AllowedModules []*NewAllowedModule `json:"allowed_modules"`
+	FieldPermissions []*NewFieldPermission `json:"field_permissions"`
+	AllBranches    *bool               `json:"all_branches"`
+	ParentRoleIds  []int               `json:"parent_role_ids"`
 }
 
 type NewAllowedModule struct {
@@ -34,81 +43,285 @@ func extractModuleActions(s string) []string {
 	return strings.Split(strings.ToLower(s), ";")
 }
 
-// retrieve allowed query paths for role
-func GetQueryPathsFromRole(ctx context.Context, roleId int) (map[string]bool, error) {
+// key of a module action in permission maps, case insensitive
+func PermissionKey(module string, action string) string {
+	return strings.ToLower(module) + ":" + strings.ToLower(action)
+}
+
+// retrieve allowed module actions for role & its ancestors (union), keyed by PermissionKey
+func GetPermissionsFromRole(ctx context.Context, roleId int) (map[string]bool, error) {
 	db := config.GetDB()
-	var role Role
-	if err := db.WithContext(ctx).
-			Preload("RoleModules").
-			Preload("RoleModules.Module").
-			Where("id = ?", roleId).
-			First(&role).Error; err != nil {
+	if err := utils.ValidateResourceId[Role](ctx, roleId); err != nil {
 		return nil, errors.New("role not found")
 	}
+	ancestorIds, err := getAncestorRoleIds(ctx, db, roleId)
+	if err != nil {
+		return nil, err
+	}
+
+	var roleModules []*RoleModule
+	if err := db.WithContext(ctx).
+			Preload("Module").
+			Where("role_id IN ?", append([]int{roleId}, ancestorIds...)).
+			Find(&roleModules).Error; err != nil {
+		return nil, err
+	}
 
-	allowedPaths := make(map[string]bool, 0)
-	for _, permission := range role.RoleModules {
-		validActions := extractModuleActions(permission.Module.Actions)
+	permissions := make(map[string]bool, 0)
+	for _, permission := range roleModules {
 		allowedActions := extractModuleActions(permission.AllowedActions)
-		module := permission.Module.Name
 
 		for _, action := range allowedActions {
-			// check if the action is valid
-
-			if slices.Contains(validActions, action) {
-				// changing case of action & module for older module name convention
-				module = utils.UppercaseFirst(module)
-				switch action {
-				case "read":
-					allowedPaths["get"+module] = true
-					allowedPaths["paginate"+module] = true
-					// Check if module ends with 'y' to change to plural 'ies'
-					if strings.HasSuffix(module, "y") {
-						allowedPaths["get"+module[:len(module)-1]+"ies"] = true
-					} else {
-						// Just add 's' for general cases
-						allowedPaths["get"+module+"s"] = true
-					}
-				case "update":
-					allowedPaths["update"+module] = true
-					allowedPaths["toggleActive"+module] = true
-				case "upload":
-    				allowedPaths["uploadSingle"+module] = true
-    				allowedPaths["uploadMultiple"+module] = true
-				default:
-					action = utils.LowercaseFirst(action)
-					allowedPaths[action+module] = true
-				}
+			// only actions of the module registry are valid
+			if IsRegisteredAction(permission.Module.Name, action) {
+				permissions[PermissionKey(permission.Module.Name, action)] = true
+			}
+		}
+	}
+	return permissions, nil
+}
+
+// retrieve role's permissions from redis or db, cached until ClearPermissionsCache or modules change
+func GetRolePermissions(ctx context.Context, roleId int) (map[string]bool, error) {
+	key := "Permissions:Role:" + fmt.Sprint(roleId)
+	var permissions map[string]bool
+	exists, err := config.GetRedisObject(key, &permissions)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return permissions, nil
+	}
+
+	version := utils.GetPermissionsVersion()
+	permissions, err = GetPermissionsFromRole(ctx, roleId)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.TagRedisKey(key, 0, utils.RedisTags[Module](ctx)...); err != nil {
+		return nil, err
+	}
+	if err := utils.StorePermissionsCache(key, &permissions, version); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// retrieve role's permission version from redis or db, cached until ClearPermissionsCache
+func GetRolePermissionVersion(ctx context.Context, roleId int) (int, error) {
+	key := "PermissionVersion:Role:" + fmt.Sprint(roleId)
+	var version int
+	exists, err := config.GetRedisObject(key, &version)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return version, nil
+	}
+
+	cacheVersion := utils.GetPermissionsVersion()
+	db := config.GetDB()
+	if err := db.WithContext(ctx).Model(&Role{}).
+		Where("id = ?", roleId).
+		Pluck("permission_version", &version).Error; err != nil {
+		return 0, err
+	}
+	if err := utils.StorePermissionsCache(key, &version, cacheVersion); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// bump permission version of roles & their descendants, tokens issued before are rejected
+// returns the bumped roles, their cache is cleared with utils.ClearPermissionsCache once tx is committed
+func bumpPermissionVersion(ctx context.Context, tx *gorm.DB, roleIds ...int) ([]int, error) {
+	if len(roleIds) == 0 {
+		return nil, nil
+	}
+	// children inherit the changed permissions
+	descendantIds, err := getDescendantRoleIds(ctx, tx, roleIds...)
+	if err != nil {
+		return nil, err
+	}
+	roleIds = append(roleIds, descendantIds...)
+	if err := tx.WithContext(ctx).Model(&Role{}).
+		Where("id IN ?", roleIds).
+		UpdateColumn("permission_version", gorm.Expr("permission_version + 1")).Error; err != nil {
+		return nil, err
+	}
+	return roleIds, nil
+}
+
+// active role ids of current user or role of api key
+func getCallerRoleIds(ctx context.Context) ([]int, error) {
+	if apiKeyId, ok := utils.GetApiKeyIdFromContext(ctx); ok && apiKeyId > 0 {
+		apiKey, err := GetApiKey(ctx, apiKeyId)
+		if err != nil {
+			return nil, err
+		}
+		return []int{apiKey.RoleId}, nil
+	}
+
+	userId, ok := utils.GetUserIdFromContext(ctx)
+	if !ok || userId == 0 {
+		return nil, errors.New("user id is required")
+	}
+	return GetUserActiveRoleIds(ctx, userId)
+}
+
+// caller can't hand out a role allowing more than the caller's own roles
+func ensureRoleWithinCaller(ctx context.Context, roleId int) error {
+	return ensureRolesWithinCaller(ctx, []int{roleId})
+}
+
+// roles together can't allow more than the caller's own roles
+func ensureRolesWithinCaller(ctx context.Context, roleIds []int) error {
+	callerRoleIds, err := getCallerRoleIds(ctx)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(roleIds, func(roleId int) bool { return !slices.Contains(callerRoleIds, roleId) }) {
+		return nil
+	}
+
+	callerReach, err := getRoleReach(ctx, callerRoleIds)
+	if err != nil {
+		return err
+	}
+	reach, err := getRoleReach(ctx, roleIds)
+	if err != nil {
+		return err
+	}
+	return callerReach.ensureCovers(reach)
+}
+
+// what roles allow together, branches, permissions & fields
+type roleReach struct {
+	allBranches bool
+	permissions map[string]bool
+	fieldRules  map[string]FieldAccess
+}
+
+func getRoleReach(ctx context.Context, roleIds []int) (*roleReach, error) {
+	db := config.GetDB()
+	var allBranchesCount int64
+	if err := db.WithContext(ctx).Model(&Role{}).
+		Where("id IN ? AND all_branches = ?", roleIds, true).
+		Count(&allBranchesCount).Error; err != nil {
+		return nil, err
+	}
+	permissions, err := GetPermissionsFromRoles(ctx, roleIds)
+	if err != nil {
+		return nil, err
+	}
+	fieldRules, err := GetFieldRulesFromRoles(ctx, roleIds)
+	if err != nil {
+		return nil, err
+	}
+	return &roleReach{
+		allBranches: allBranchesCount > 0,
+		permissions: permissions,
+		fieldRules:  fieldRules,
+	}, nil
+}
+
+// fails if other allows anything reach doesn't
+func (reach roleReach) ensureCovers(other *roleReach) error {
+	if other.allBranches && !reach.allBranches {
+		return errors.New("role can see branches not assigned to you")
+	}
+	for permission, allowed := range other.permissions {
+		if allowed && !reach.permissions[permission] {
+			return errors.New("role has more permissions than your own")
+		}
+	}
+	// fields hidden from the caller must stay hidden
+	for field, access := range reach.fieldRules {
+		if other.fieldRules[field].rank() < access.rank() {
+			return errors.New("role can see fields hidden from you")
+		}
+	}
+	return nil
+}
+
+// reach a role created or updated with these would have, permissions of its parents included
+func getNewRoleReach(ctx context.Context, allBranches bool, roleModules []*RoleModule, fieldPermissions []*FieldPermission, roleParents []*RoleParent) (*roleReach, error) {
+	parentRoleIds := make([]int, 0, len(roleParents))
+	for _, roleParent := range roleParents {
+		parentRoleIds = append(parentRoleIds, roleParent.ParentRoleId)
+	}
+	permissions, err := GetPermissionsFromRoles(ctx, parentRoleIds)
+	if err != nil {
+		return nil, err
+	}
+
+	moduleNames := make(map[int]string, 0) // moduleId:name
+	modules, err := GetResources[Module](ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range modules {
+		moduleNames[m.ID] = m.Name
+	}
+	for _, roleModule := range roleModules {
+		for _, action := range extractModuleActions(roleModule.AllowedActions) {
+			if IsRegisteredAction(moduleNames[roleModule.ModuleId], action) {
+				permissions[PermissionKey(moduleNames[roleModule.ModuleId], action)] = true
 			}
 		}
 	}
-	return allowedPaths, nil
+
+	// field rules aren't inherited
+	fieldRules := make(map[string]FieldAccess, 0)
+	for _, rule := range fieldPermissions {
+		if rule.Access != FieldAccessVisible {
+			fieldRules[FieldKey(rule.TypeName, rule.FieldName)] = rule.Access
+		}
+	}
+	return &roleReach{
+		allBranches: allBranches,
+		permissions: permissions,
+		fieldRules:  fieldRules,
+	}, nil
+}
+
+// caller can't make a role allowing more than the caller's own roles
+func ensureRoleReachWithinCaller(ctx context.Context, reach *roleReach) error {
+	callerRoleIds, err := getCallerRoleIds(ctx)
+	if err != nil {
+		return err
+	}
+	callerReach, err := getRoleReach(ctx, callerRoleIds)
+	if err != nil {
+		return err
+	}
+	return callerReach.ensureCovers(reach)
 }
 
 func mapRoleModules(ctx context.Context, input []*NewAllowedModule) ([]*RoleModule, error) {
 
-	availabeModuleActions := make(map[int]string, 0) // moduleId:actions
+	moduleNames := make(map[int]string, 0) // moduleId:name
 	modules, err := GetResources[Module](ctx)
 
 	if err != nil {
 		return nil, err
 	}
 	for _, m := range modules {
-		availabeModuleActions[m.ID] = m.Actions
+		moduleNames[m.ID] = m.Name
 	}
 
 	var roleModules []*RoleModule
 	for _, permission := range input {
 
-		availableActionsString, ok := availabeModuleActions[permission.ModuleID]
-		if !ok || availableActionsString == "" {
+		// modules & actions are validated against the registry, not the stored actions
+		definition, ok := GetRegisteredModule(moduleNames[permission.ModuleID])
+		if !ok {
 			return nil, errors.New("module_id not found")
 		}
-		availableActions := extractModuleActions(availableActionsString)
 		inputActions := extractModuleActions(permission.AllowedActions)
 		for _, action := range inputActions {
-			if !slices.Contains(availableActions, action) {
-				return nil, errors.New("invalid module action")
+			if !definition.HasAction(action) {
+				return nil, errors.New("invalid module action " + action + " for " + definition.Name)
 			}
 		}
 
@@ -122,6 +335,12 @@ func mapRoleModules(ctx context.Context, input []*NewAllowedModule) ([]*RoleModu
 
 func CreateRole(ctx context.Context, input *NewRole) (*Role, error) {
 
+	if input.AllBranches != nil && *input.AllBranches {
+		if err := ensureAllBranchesWithinScope(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	// check duplicate
 	if err := utils.ValidateUnique[Role](ctx, "name", input.Name, 0); err != nil {
 		return nil, err
@@ -130,10 +349,28 @@ func CreateRole(ctx context.Context, input *NewRole) (*Role, error) {
 	if err != nil {
 		return nil, err
 	}
+	fieldPermissions, err := mapFieldPermissions(input.FieldPermissions)
+	if err != nil {
+		return nil, err
+	}
+	roleParents, err := mapRoleParents(ctx, 0, input.ParentRoleIds)
+	if err != nil {
+		return nil, err
+	}
+	reach, err := getNewRoleReach(ctx, input.AllBranches != nil && *input.AllBranches, roleModules, fieldPermissions, roleParents)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureRoleReachWithinCaller(ctx, reach); err != nil {
+		return nil, err
+	}
 
 	role := Role{
 		Name:        input.Name,
+		RoleParents: roleParents,
 		RoleModules: roleModules,
+		FieldPermissions: fieldPermissions,
+		AllBranches: input.AllBranches,
 	}
 	db := config.GetDB()
 	// tx := db.Begin()
@@ -143,7 +380,7 @@ func CreateRole(ctx context.Context, input *NewRole) (*Role, error) {
 	}
 
 	// remove Cache for Role in Redis 
-	if err := utils.RemoveRedisList[Role](); err != nil {
+	if err := utils.InvalidateRedis[Role](ctx); err != nil {
 		return nil, err
 	}
 
@@ -153,6 +390,12 @@ func CreateRole(ctx context.Context, input *NewRole) (*Role, error) {
 
 func UpdateRole(ctx context.Context, id int, input *NewRole) (*Role, error) {
 
+	if input.AllBranches != nil && *input.AllBranches {
+		if err := ensureAllBranchesWithinScope(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	// check role exists
 	if err := utils.ValidateResourceId[Role](ctx, id); err != nil {
 		return nil, err
@@ -166,13 +409,38 @@ func UpdateRole(ctx context.Context, id int, input *NewRole) (*Role, error) {
 	if err != nil {
 		return nil, err
 	}
+	fieldPermissions, err := mapFieldPermissions(input.FieldPermissions)
+	if err != nil {
+		return nil, err
+	}
+	roleParents, err := mapRoleParents(ctx, id, input.ParentRoleIds)
+	if err != nil {
+		return nil, err
+	}
+
+	db := config.GetDB()
+	allBranches := input.AllBranches
+	if allBranches == nil {
+		var existing Role
+		if err := db.WithContext(ctx).Select("all_branches").First(&existing, id).Error; err != nil {
+			return nil, err
+		}
+		allBranches = existing.AllBranches
+	}
+	// checked against the caller's roles before the change, the caller's own role included
+	reach, err := getNewRoleReach(ctx, allBranches != nil && *allBranches, roleModules, fieldPermissions, roleParents)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureRoleReachWithinCaller(ctx, reach); err != nil {
+		return nil, err
+	}
 
 	role := Role{
 		ID:         id,
 		Name:       input.Name,
 	}
 
-	db := config.GetDB()
 	tx := db.Begin()
 
 	// full replace, delete excluded
@@ -183,20 +451,49 @@ func UpdateRole(ctx context.Context, id int, input *NewRole) (*Role, error) {
 		tx.Rollback()
 		return nil, err
 	}
-	err = tx.WithContext(ctx).Model(&role).Updates(map[string]interface{}{
+	err = tx.WithContext(ctx).Model(&role).
+		Session(&gorm.Session{FullSaveAssociations: true, SkipHooks: true}).
+		Association("FieldPermissions").Unscoped().Replace(fieldPermissions)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.WithContext(ctx).Model(&role).
+		Session(&gorm.Session{FullSaveAssociations: true, SkipHooks: true}).
+		Association("RoleParents").Unscoped().Replace(roleParents)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	updates := map[string]interface{}{
 		"Name": input.Name,
-	}).Error
+	}
+	if input.AllBranches != nil {
+		updates["AllBranches"] = input.AllBranches
+	}
+	err = tx.WithContext(ctx).Model(&role).Updates(updates).Error
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 	// caching
-	if err := utils.ClearPathsCache(id); err != nil {
+	changedRoleIds, err := bumpPermissionVersion(ctx, tx, id)
+	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	// cleared once committed, so the old permissions can't be cached again
+	if err := utils.ClearPermissionsCache(changedRoleIds...); err != nil {
+		return nil, err
+	}
+	if err := utils.InvalidateRedis[Role](ctx, id); err != nil {
+		return nil, err
+	}
 
-	return &role, tx.Commit().Error
+	return &role, nil
 }
 
 func DeleteRole(ctx context.Context, id int) (*Role, error) {
@@ -217,22 +514,42 @@ func DeleteRole(ctx context.Context, id int) (*Role, error) {
 	if count > 0 {
 		return nil, errors.New("role has been used")
 	}
+	var grantCount int64
+	if err := db.WithContext(ctx).Model(&UserRole{}).Where("role_id = ?", id).Count(&grantCount).Error; err != nil {
+		return nil, err
+	}
+	if grantCount > 0 {
+		return nil, errors.New("role has been used")
+	}
+	// don't allow if other roles inherit from it
+	var childCount int64
+	if err := db.WithContext(ctx).Model(&RoleParent{}).Where("parent_role_id = ?", id).Count(&childCount).Error; err != nil {
+		return nil, err
+	}
+	if childCount > 0 {
+		return nil, errors.New("role is inherited by other roles")
+	}
 
 	tx := db.Begin()
 	// delete role
-	err = tx.WithContext(ctx).Select("RoleModules").Delete(&role).Error
+	err = tx.WithContext(ctx).Select("RoleModules", "FieldPermissions", "RoleParents").Delete(&role).Error
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
 	// remove from redis
-	// caching
-	if err := utils.ClearPathsCache(id); err != nil {
-		tx.Rollback()
+	if err := utils.ClearPermissionsCache(id); err != nil {
 		return nil, err
 	}
-	return &role, tx.Commit().Error
+	if err := utils.InvalidateRedis[Role](ctx, id); err != nil {
+		return nil, err
+	}
+	return &role, nil
 }
 
 func GetRole(ctx context.Context, id int) (*Role, error) {
@@ -243,7 +560,7 @@ func GetRole(ctx context.Context, id int) (*Role, error) {
 
 func GetRoles(ctx context.Context, name *string) ([]*Role, error) {
 
-	results, err := GetResources[Role](ctx, "created_at")
+	results, err := GetFilteredResources[Role](ctx, map[string]any{"name": name}, whereLike("name"), "created_at")
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm"
+)
+
+// role inherits every permission of its parent roles
+type RoleParent struct {
+	RoleId       int       `gorm:"primary_key;autoIncrement:false;not null" json:"role_id"`
+	ParentRoleId int       `gorm:"primary_key;autoIncrement:false;not null;index" json:"parent_role_id"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// module action of a role, direct or inherited from ancestor roles
+type RolePermission struct {
+	Module        string  `json:"module"`
+	Action        string  `json:"action"`
+	Direct        bool    `json:"direct"`
+	InheritedFrom []*Role `json:"inherited_from"`
+}
+
+// walk role_parents from roleIds, up to parents or down to children, roleIds excluded
+func walkRoleParents(ctx context.Context, db *gorm.DB, roleIds []int, up bool) ([]int, error) {
+	fromColumn, toColumn := "parent_role_id", "role_id"
+	if up {
+		fromColumn, toColumn = "role_id", "parent_role_id"
+	}
+
+	visited := make(map[int]bool, len(roleIds))
+	for _, roleId := range roleIds {
+		visited[roleId] = true
+	}
+	var result []int
+	frontier := roleIds
+	for len(frontier) > 0 {
+		var next []int
+		if err := db.WithContext(ctx).Model(&RoleParent{}).
+			Where(fromColumn+" IN ?", frontier).
+			Pluck(toColumn, &next).Error; err != nil {
+			return nil, err
+		}
+		frontier = nil
+		for _, roleId := range next {
+			if !visited[roleId] {
+				visited[roleId] = true
+				result = append(result, roleId)
+				frontier = append(frontier, roleId)
+			}
+		}
+	}
+	return result, nil
+}
+
+func getAncestorRoleIds(ctx context.Context, db *gorm.DB, roleId int) ([]int, error) {
+	return walkRoleParents(ctx, db, []int{roleId}, true)
+}
+
+func getDescendantRoleIds(ctx context.Context, db *gorm.DB, roleIds ...int) ([]int, error) {
+	return walkRoleParents(ctx, db, roleIds, false)
+}
+
+// validate parents, a role can't inherit from itself or its descendants (id = 0 for create)
+func mapRoleParents(ctx context.Context, id int, parentRoleIds []int) ([]*RoleParent, error) {
+
+	parentRoleIds = utils.UniqueSlice(parentRoleIds)
+	if len(parentRoleIds) == 0 {
+		return []*RoleParent{}, nil
+	}
+	if err := utils.ValidateResourcesId[Role](ctx, parentRoleIds); err != nil {
+		return nil, errors.New("parent role not found")
+	}
+
+	if id > 0 {
+		descendants, err := getDescendantRoleIds(ctx, config.GetDB(), id)
+		if err != nil {
+			return nil, err
+		}
+		for _, parentRoleId := range parentRoleIds {
+			if parentRoleId == id || slices.Contains(descendants, parentRoleId) {
+				return nil, errors.New("role inheritance cycle detected")
+			}
+		}
+	}
+
+	roleParents := make([]*RoleParent, 0, len(parentRoleIds))
+	for _, parentRoleId := range parentRoleIds {
+		roleParents = append(roleParents, &RoleParent{
+			RoleId:       id,
+			ParentRoleId: parentRoleId,
+		})
+	}
+	return roleParents, nil
+}
+
+func GetParentRoles(ctx context.Context, roleId int) ([]*Role, error) {
+
+	db := config.GetDB()
+	var results []*Role
+
+	err := db.WithContext(ctx).
+		Joins("JOIN role_parents ON role_parents.parent_role_id = roles.id").
+		Where("role_parents.role_id = ?", roleId).
+		Order("roles.name").
+		Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// direct & inherited module actions of role, inherited ones list the ancestors granting them
+func GetRolePermissionDetails(ctx context.Context, roleId int) ([]*RolePermission, error) {
+
+	db := config.GetDB()
+	ancestorIds, err := getAncestorRoleIds(ctx, db, roleId)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []*Role
+	if err := db.WithContext(ctx).
+		Preload("RoleModules").
+		Preload("RoleModules.Module").
+		Where("id IN ?", append([]int{roleId}, ancestorIds...)).
+		Order("name").
+		Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]*RolePermission, 0)
+	byKey := make(map[string]*RolePermission)
+	for _, role := range roles {
+		for _, roleModule := range role.RoleModules {
+			for _, action := range strings.Split(roleModule.Module.Actions, ";") {
+				if !slices.Contains(extractModuleActions(roleModule.AllowedActions), strings.ToLower(action)) {
+					continue
+				}
+				// stored actions no longer registered grant nothing
+				if !IsRegisteredAction(roleModule.Module.Name, action) {
+					continue
+				}
+				key := PermissionKey(roleModule.Module.Name, action)
+				permission, ok := byKey[key]
+				if !ok {
+					permission = &RolePermission{
+						Module:        roleModule.Module.Name,
+						Action:        action,
+						InheritedFrom: []*Role{},
+					}
+					byKey[key] = permission
+					results = append(results, permission)
+				}
+				if role.ID == roleId {
+					permission.Direct = true
+				} else {
+					permission.InheritedFrom = append(permission.InheritedFrom, role)
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(results, func(a, b *RolePermission) int {
+		return strings.Compare(PermissionKey(a.Module, a.Action), PermissionKey(b.Module, b.Action))
+	})
+	return results, nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+)
+
+func callerReach() roleReach {
+	return roleReach{
+		permissions: map[string]bool{"unit:read": true, "unit:update": true},
+		fieldRules:  map[string]FieldAccess{"User.email": FieldAccessMasked, "User.phone": FieldAccessDenied},
+	}
+}
+
+func TestRoleReachCoversNarrowerRoles(t *testing.T) {
+	caller := callerReach()
+
+	// fewer permissions & fields hidden at least as much
+	role := &roleReach{
+		permissions: map[string]bool{"unit:read": true, "product:update": false},
+		fieldRules:  map[string]FieldAccess{"User.email": FieldAccessDenied, "User.phone": FieldAccessDenied},
+	}
+	if err := caller.ensureCovers(role); err != nil {
+		t.Errorf("ensureCovers() error = %v", err)
+	}
+	if err := caller.ensureCovers(&caller); err != nil {
+		t.Errorf("ensureCovers() of the caller's own reach error = %v", err)
+	}
+
+	everywhere := roleReach{allBranches: true}
+	if err := everywhere.ensureCovers(&roleReach{allBranches: true}); err != nil {
+		t.Errorf("ensureCovers() of all branches by all branches error = %v", err)
+	}
+}
+
+func TestRoleReachRefusesWiderRoles(t *testing.T) {
+	caller := callerReach()
+
+	err := caller.ensureCovers(&roleReach{allBranches: true, fieldRules: caller.fieldRules})
+	if err == nil || err.Error() != "role can see branches not assigned to you" {
+		t.Errorf("ensureCovers() of all branches error = %v", err)
+	}
+
+	err = caller.ensureCovers(&roleReach{permissions: map[string]bool{"product:update": true}, fieldRules: caller.fieldRules})
+	if err == nil || err.Error() != "role has more permissions than your own" {
+		t.Errorf("ensureCovers() of another permission error = %v", err)
+	}
+
+	// no rule for email makes it visible
+	err = caller.ensureCovers(&roleReach{fieldRules: map[string]FieldAccess{"User.phone": FieldAccessDenied}})
+	if err == nil || err.Error() != "role can see fields hidden from you" {
+		t.Errorf("ensureCovers() of a masked field made visible error = %v", err)
+	}
+	err = caller.ensureCovers(&roleReach{fieldRules: map[string]FieldAccess{"User.email": FieldAccessMasked, "User.phone": FieldAccessMasked}})
+	if err == nil || err.Error() != "role can see fields hidden from you" {
+		t.Errorf("ensureCovers() of a denied field masked error = %v", err)
+	}
+}
+
+func TestNewRoleReachOfFieldPermissions(t *testing.T) {
+	config.SetDB(newDryRunDB(t))
+	config.SetCache(config.NewMemoryCache(100))
+	caller := callerReach()
+
+	fieldPermissions, err := mapFieldPermissions([]*NewFieldPermission{
+		{TypeName: "User", FieldName: "email", Access: FieldAccessMasked},
+		{TypeName: "User", FieldName: "phone", Access: FieldAccessVisible},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reach, err := getNewRoleReach(context.Background(), false, nil, fieldPermissions, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// phone is denied to the caller
+	if err := caller.ensureCovers(reach); err == nil || err.Error() != "role can see fields hidden from you" {
+		t.Errorf("ensureCovers() of a role showing phone error = %v", err)
+	}
+
+	reach, err = getNewRoleReach(context.Background(), true, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reach.allBranches {
+		t.Error("getNewRoleReach() lost all branches")
+	}
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"reflect"
+
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// models owned by a business, isolated by business_id
+type TenantScoped interface {
+	GetBusinessId() string
+}
+
+func (user User) GetBusinessId() string {
+	return user.BusinessId
+}
+
+func (role Role) GetBusinessId() string {
+	return role.BusinessId
+}
+
+func (unit Unit) GetBusinessId() string {
+	return unit.BusinessId
+}
+
+func (category Category) GetBusinessId() string {
+	return category.BusinessId
+}
+
+func (p Product) GetBusinessId() string {
+	return p.BusinessId
+}
+
+func (i Image) GetBusinessId() string {
+	return i.BusinessId
+}
+
+func (k ApiKey) GetBusinessId() string {
+	return k.BusinessId
+}
+
+func (branch Branch) GetBusinessId() string {
+	return branch.BusinessId
+}
+
+// add business_id = ? to queries, updates & deletes of TenantScoped models
+// and set business_id on create, whenever the context carries a business
+func RegisterTenantScope(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("tenant_scope:create", setTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("tenant_scope:query", applyTenantScope); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenant_scope:update", applyTenantScope); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("tenant_scope:delete", applyTenantScope); err != nil {
+		return err
+	}
+	return nil
+}
+
+func isTenantScoped(db *gorm.DB) bool {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return false
+	}
+	_, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(TenantScoped)
+	return ok
+}
+
+func applyTenantScope(db *gorm.DB) {
+	if !isTenantScoped(db) {
+		return
+	}
+	businessId, ok := utils.GetBusinessIdFromContext(db.Statement.Context)
+	if !ok {
+		// fails closed, only system queries may cross businesses
+		if !utils.IsWithoutTenant(db.Statement.Context) {
+			db.AddError(utils.ErrNoTenant)
+		}
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "business_id"}, Value: businessId},
+	}})
+}
+
+// records always belong to the caller's business, whatever was given
+// without one in ctx, e.g. creating a business, they must name their business
+func setTenant(db *gorm.DB) {
+	if !isTenantScoped(db) {
+		return
+	}
+	businessId, ok := utils.GetBusinessIdFromContext(db.Statement.Context)
+	if !ok {
+		if !hasBusinessIds(db) {
+			db.AddError(utils.ErrNoTenant)
+		}
+		return
+	}
+	db.Statement.SetColumn("BusinessId", businessId, true)
+}
+
+// whether every record being created has a business id
+func hasBusinessIds(db *gorm.DB) bool {
+	field := db.Statement.Schema.LookUpField("BusinessId")
+	if field == nil {
+		return false
+	}
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if _, zero := field.ValueOf(db.Statement.Context, reflect.Indirect(rv.Index(i))); zero {
+				return false
+			}
+		}
+		return rv.Len() > 0
+	case reflect.Struct:
+		_, zero := field.ValueOf(db.Statement.Context, rv)
+		return !zero
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// statements are built but never sent, so no database is needed
+func newDryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "test:test@tcp(127.0.0.1:3306)/test",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTenantScopedDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newDryRunDB(t)
+	if err := RegisterTenantScope(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func assertScopedTo(t *testing.T, result *gorm.DB, businessId string) {
+	t.Helper()
+	if result.Error != nil {
+		t.Fatalf("error = %v", result.Error)
+	}
+	sql := result.Statement.SQL.String()
+	if !strings.Contains(sql, "`units`.`business_id` = ?") {
+		t.Errorf("sql = %s, want it scoped to the business", sql)
+	}
+	if !slices.Contains(result.Statement.Vars, any(businessId)) {
+		t.Errorf("vars = %v, want %s", result.Statement.Vars, businessId)
+	}
+}
+
+func TestTenantScopeOfStatements(t *testing.T) {
+	db := newTenantScopedDB(t)
+	business := db.WithContext(utils.WithBusiness(context.Background(), "business-1"))
+
+	assertScopedTo(t, business.Where("name = ?", "kg").Find(&[]Unit{}), "business-1")
+	assertScopedTo(t, business.Model(&Unit{ID: 1}).Update("name", "kg"), "business-1")
+	assertScopedTo(t, business.Delete(&Unit{ID: 1}), "business-1")
+}
+
+func TestTenantScopeFailsClosedWithoutBusiness(t *testing.T) {
+	db := newTenantScopedDB(t).WithContext(context.Background())
+
+	if err := db.Find(&[]Unit{}).Error; !errors.Is(err, utils.ErrNoTenant) {
+		t.Errorf("query error = %v, want %v", err, utils.ErrNoTenant)
+	}
+	if err := db.Model(&Unit{ID: 1}).Update("name", "kg").Error; !errors.Is(err, utils.ErrNoTenant) {
+		t.Errorf("update error = %v, want %v", err, utils.ErrNoTenant)
+	}
+	if err := db.Delete(&Unit{ID: 1}).Error; !errors.Is(err, utils.ErrNoTenant) {
+		t.Errorf("delete error = %v, want %v", err, utils.ErrNoTenant)
+	}
+}
+
+func TestTenantScopeSkipped(t *testing.T) {
+	db := newTenantScopedDB(t)
+
+	system := db.WithContext(utils.WithoutTenant(context.Background())).Find(&[]Unit{})
+	if system.Error != nil || strings.Contains(system.Statement.SQL.String(), "business_id") {
+		t.Errorf("system query = %s, %v, want it across businesses", system.Statement.SQL.String(), system.Error)
+	}
+
+	// modules are shared by every business
+	shared := db.WithContext(context.Background()).Find(&[]Module{})
+	if shared.Error != nil || strings.Contains(shared.Statement.SQL.String(), "business_id") {
+		t.Errorf("module query = %s, %v, want it unscoped", shared.Statement.SQL.String(), shared.Error)
+	}
+}
+
+func TestTenantScopeOfCreate(t *testing.T) {
+	db := newTenantScopedDB(t)
+
+	// the business of ctx wins over the one given
+	unit := Unit{BusinessId: "business-2", Name: "kg"}
+	if err := db.WithContext(utils.WithBusiness(context.Background(), "business-1")).Create(&unit).Error; err != nil {
+		t.Fatal(err)
+	}
+	if unit.BusinessId != "business-1" {
+		t.Errorf("created in %s, want business-1", unit.BusinessId)
+	}
+
+	// e.g. seeding, the record names its business
+	unit = Unit{BusinessId: "business-2", Name: "kg"}
+	if err := db.WithContext(context.Background()).Create(&unit).Error; err != nil || unit.BusinessId != "business-2" {
+		t.Errorf("created in %s, %v, want business-2", unit.BusinessId, err)
+	}
+
+	if err := db.WithContext(context.Background()).Create(&Unit{Name: "kg"}).Error; !errors.Is(err, utils.ErrNoTenant) {
+		t.Errorf("create without any business error = %v, want %v", err, utils.ErrNoTenant)
+	}
+	units := []Unit{{BusinessId: "business-2", Name: "kg"}, {Name: "g"}}
+	if err := db.WithContext(context.Background()).Create(&units).Error; !errors.Is(err, utils.ErrNoTenant) {
+		t.Errorf("batch create with a record without business error = %v, want %v", err, utils.ErrNoTenant)
+	}
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"context"
 	"errors"
+	"io"
+	"strconv"
 	"time"
 
 	"github.com/aungmyozaw92/go-graphql/config"
@@ -11,6 +13,7 @@ import (
 
 type Unit struct {
 	ID           int       `gorm:"primary_key" json:"id"`
+	BusinessId   string    `gorm:"index;size:36;not null" json:"business_id"`
 	Name         string    `gorm:"size:20;not null" json:"name" binding:"required"`
 	Abbreviation string    `gorm:"size:10;not null" json:"abbreviation" binding:"required"`
 	Precision    Precision `gorm:"type:enum('0','1','2','3','4');default:'0';size:1;not null" json:"precision" binding:"required"`
@@ -29,14 +32,62 @@ type UnitsEdge Edge[Unit]
 type UnitsConnection struct {
 	PageInfo *PageInfo      `json:"pageInfo"`
 	Edges    []*UnitsEdge 	`json:"edges"`
+	TotalCounter
 }
 
-// node
-// returns decoded curosr string
-func (pu Unit) GetCursor() string {
-	return pu.CreatedAt.String()
+// sortable fields of paginateUnit
+type UnitOrderField string
+
+const (
+	UnitOrderFieldName         UnitOrderField = "NAME"
+	UnitOrderFieldAbbreviation UnitOrderField = "ABBREVIATION"
+	UnitOrderFieldCreatedAt    UnitOrderField = "CREATED_AT"
+	UnitOrderFieldUpdatedAt    UnitOrderField = "UPDATED_AT"
+)
+
+func (f UnitOrderField) column() (string, bool) {
+	switch f {
+	case UnitOrderFieldName:
+		return "name", true
+	case UnitOrderFieldAbbreviation:
+		return "abbreviation", true
+	case UnitOrderFieldCreatedAt:
+		return "created_at", true
+	case UnitOrderFieldUpdatedAt:
+		return "updated_at", true
+	}
+	return "", false
+}
+
+func (f UnitOrderField) MarshalGQL(w io.Writer) {
+	w.Write([]byte(strconv.Quote(string(f))))
+}
+
+func (f *UnitOrderField) UnmarshalGQL(i interface{}) error {
+	return unmarshalOrderField(i, f)
+}
+
+type UnitOrder struct {
+	OrderBy[UnitOrderField]
 }
 
+// filterable columns of Unit, one line each
+type UnitFilter struct {
+	Name         *StringFilter  `filter:"name"`
+	Abbreviation *StringFilter  `filter:"abbreviation"`
+	IsActive     *BooleanFilter `filter:"is_active"`
+	CreatedAt    *TimeFilter    `filter:"created_at"`
+	And          []*UnitFilter
+	Or           []*UnitFilter
+	Not          *UnitFilter
+}
+
+// filter with the deprecated arguments of paginateUnit
+func UnitFilterWithArgs(filter *UnitFilter, name *string) *UnitFilter {
+	return withArgsFilter(filter, &UnitFilter{Name: containsFilter(name)})
+}
+
+
 func (input *NewUnit) validate(ctx context.Context, id int) error {
 	if err := utils.ValidateUnique[Unit](ctx, "name", input.Name, id); err != nil {
 		return err
@@ -69,7 +120,7 @@ func CreateUnit(ctx context.Context, input *NewUnit) (*Unit, error) {
 	}
 
 	// remove Cache for Unit in Redis 
-	if err := utils.RemoveRedisList[Unit](); err != nil {
+	if err := utils.InvalidateRedis[Unit](ctx); err != nil {
 		return nil, err
 	}
 
@@ -102,7 +153,7 @@ func UpdateUnit(ctx context.Context, id int, input *NewUnit) (*Unit, error) {
 
 
 	// remove Cache for Module in Redis 
-	if err := RemoveRedisBoth(unit); err != nil {
+	if err := utils.InvalidateRedis[Unit](ctx, unit.ID); err != nil {
 		return nil, err
 	}
 
@@ -143,7 +194,7 @@ func DeleteUnit(ctx context.Context, id int) (*Unit, error) {
 	}
 
 	// remove Cache for Unit in Redis 
-	if err := utils.RemoveRedisList[Unit](); err != nil {
+	if err := utils.InvalidateRedis[Unit](ctx, unit.ID); err != nil {
 		return nil, err
 	}
 
@@ -169,7 +220,7 @@ func ToggleActiveUnit(ctx context.Context, id int, isActive bool) (*Unit, error)
 	}
 
 	// remove Cache for Unit in Redis 
-	if err := RemoveRedisBoth(unit); err != nil {
+	if err := utils.InvalidateRedis[Unit](ctx, unit.ID); err != nil {
 		return nil, err
 	}
 
@@ -184,7 +235,7 @@ func GetUnit(ctx context.Context, id int) (*Unit, error) {
 
 func GetUnits(ctx context.Context, name *string) ([]*Unit, error) {
 
-	results, err := GetResources[Unit](ctx, "name")
+	results, err := GetFilteredResources[Unit](ctx, map[string]any{"name": name}, whereLike("name"), "name")
 
 	if err != nil {
 		return nil, err
@@ -194,23 +245,28 @@ func GetUnits(ctx context.Context, name *string) ([]*Unit, error) {
 }
 
 
-func PaginateUnit(ctx context.Context, limit *int, after *string, name *string) (*UnitsConnection, error) {
+func PaginateUnit(ctx context.Context, args PageArgs, orderBy []*UnitOrder, filter *UnitFilter) (*UnitsConnection, error) {
 
 	db := config.GetDB()
 	dbCtx := db.WithContext(ctx)
 
-	if name != nil && *name != "" {
-		dbCtx.Where("name LIKE ?", "%"+*name+"%")
+	dbCtx, err := applyFilter(ctx, dbCtx, filter)
+	if err != nil {
+		return nil, err
 	}
 
-	// edges, pageInfo, err := FetchPagePureCursor[Unit](dbCtx, *limit, after, "name", ">")
-	edges, pageInfo, err := FetchPageCompositeCursor[Unit](dbCtx, *limit, after, "name", ">")
+	orders, err := getPageOrders(ctx, orderBy, PageOrder{Column: "name"})
+	if err != nil {
+		return nil, err
+	}
+	edges, pageInfo, counter, err := FetchPage[Unit](dbCtx, args, orders...)
 	if err != nil {
 		return nil, err
 	}
 
 	var UnitsConnection UnitsConnection
 	UnitsConnection.PageInfo = pageInfo
+	UnitsConnection.TotalCounter = counter
 
 	for _, edge := range edges {
 		UnitEdge := UnitsEdge(edge)
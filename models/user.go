@@ -4,25 +4,33 @@ import (
 	"context"
 	"errors"
 	"html"
+	"io"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aungmyozaw92/go-graphql/config"
 	"github.com/aungmyozaw92/go-graphql/utils"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type User struct {
 	ID         int       `gorm:"primary_key" json:"id"`
-	Username   string    `gorm:"size:100;not null;unique" json:"username" binding:"required"`
+	BusinessId string    `gorm:"size:36;not null;uniqueIndex:idx_users_business_username;uniqueIndex:idx_users_business_email;uniqueIndex:idx_users_oidc" json:"business_id"`
+	Username   string    `gorm:"size:100;not null;uniqueIndex:idx_users_business_username" json:"username" binding:"required"`
 	Name       string    `gorm:"size:100;not null" json:"name" binding:"required"`
-	Email      string    `gorm:"size:100;unique;default:null" json:"email"`
+	Email      string    `gorm:"size:100;default:null;uniqueIndex:idx_users_business_email" json:"email"`
 	Phone      string    `gorm:"size:20" json:"phone"`
 	Mobile     string    `gorm:"size:20" json:"mobile"`
 	ImageUrl   string    `json:"image_url"`
 	Password   string    `gorm:"size:255;not null" json:"password"`
 	IsActive   *bool     `gorm:"not null" json:"is_active"`
 	RoleId     int       `gorm:"not null;default:0" json:"role_id" binding:"required"`
+	PasswordChangedAt *time.Time `gorm:"default:null" json:"password_changed_at"`
+	OidcIssuer  string    `gorm:"size:255;default:null;uniqueIndex:idx_users_oidc" json:"oidc_issuer"`
+	OidcSubject string    `gorm:"size:255;default:null;uniqueIndex:idx_users_oidc" json:"oidc_subject"`
+	// created by an oidc login, the idp then keeps its role & name in sync
+	OidcProvisioned bool `gorm:"not null;default:false" json:"oidc_provisioned"`
 	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -37,6 +45,8 @@ type NewUser struct {
 	Password   string   `json:"password"`
 	IsActive   *bool    `json:"is_active"`
 	RoleId     int      `json:"role_id"`
+	BranchIds  []int    `json:"branch_ids"`
+	RoleGrants []*NewUserRole `json:"role_grants"`
 }
 
 type LoginInfo struct {
@@ -50,6 +60,9 @@ type LoginInfo struct {
 	Mobile     string   `json:"mobile"`
 	ImageUrl   string   `json:"image_url"`
 	Modules    []AllowedModule `json:"modules"`
+	MustChangePassword bool `json:"must_change_password"`
+	IsImpersonated bool     `json:"is_impersonated"`
+	ImpersonatedBy string   `json:"impersonated_by"`
 }
 
 type AllowedModule struct {
@@ -66,62 +79,191 @@ type UsersEdge Edge[User]
 type UsersConnection struct {
 	PageInfo 	*PageInfo    	`json:"pageInfo"`
 	Edges    	[]*UsersEdge 	`json:"edges"`
+	TotalCounter
 }
 
-// node
-// returns decoded curosr string
-func (s User) GetCursor() string {
-	return s.CreatedAt.String()
+// sortable fields of paginateUser
+type UserOrderField string
+
+const (
+	UserOrderFieldName      UserOrderField = "NAME"
+	UserOrderFieldUsername  UserOrderField = "USERNAME"
+	UserOrderFieldCreatedAt UserOrderField = "CREATED_AT"
+	UserOrderFieldUpdatedAt UserOrderField = "UPDATED_AT"
+)
+
+func (f UserOrderField) column() (string, bool) {
+	switch f {
+	case UserOrderFieldName:
+		return "name", true
+	case UserOrderFieldUsername:
+		return "username", true
+	case UserOrderFieldCreatedAt:
+		return "created_at", true
+	case UserOrderFieldUpdatedAt:
+		return "updated_at", true
+	}
+	return "", false
+}
+
+func (f UserOrderField) MarshalGQL(w io.Writer) {
+	w.Write([]byte(strconv.Quote(string(f))))
 }
 
+func (f *UserOrderField) UnmarshalGQL(i interface{}) error {
+	return unmarshalOrderField(i, f)
+}
 
-func Login(ctx context.Context, username string, password string) (*LoginInfo, error) {
+type UserOrder struct {
+	OrderBy[UserOrderField]
+}
+
+// filterable columns of User, one line each
+type UserFilter struct {
+	Name      *StringFilter  `filter:"name"`
+	Username  *StringFilter  `filter:"username"`
+	Email     *StringFilter  `filter:"email"`
+	Phone     *StringFilter  `filter:"phone"`
+	Mobile    *StringFilter  `filter:"mobile"`
+	IsActive  *BooleanFilter `filter:"is_active"`
+	RoleId    *IntFilter     `filter:"role_id"`
+	CreatedAt *TimeFilter    `filter:"created_at"`
+	And       []*UserFilter
+	Or        []*UserFilter
+	Not       *UserFilter
+}
+
+// filter with the deprecated arguments of getUsers & paginateUser
+func UserFilterWithArgs(filter *UserFilter, name *string, phone *string, mobile *string, email *string, isActive *bool) *UserFilter {
+	return withArgsFilter(filter, &UserFilter{
+		Name:     containsFilter(name),
+		Phone:    containsFilter(phone),
+		Mobile:   containsFilter(mobile),
+		Email:    containsFilter(email),
+		IsActive: booleanEqFilter(isActive),
+	})
+}
+
+
+
+// businessId can be empty when there is only one business
+func Login(ctx context.Context, username string, password string, businessId *string) (*LoginInfo, error) {
 
 	db := config.GetDB()
 	var err error
 	var result LoginInfo
 
+	if businessId == nil || *businessId == "" {
+		defaultBusinessId, err := getDefaultBusinessId(ctx, db)
+		if err != nil {
+			return &result, err
+		}
+		businessId = &defaultBusinessId
+	}
+	// the user's roles & modules are read within the business too
+	ctx = utils.WithBusiness(ctx, *businessId)
+
 	user := User{}
 
-	err = db.WithContext(ctx).Model(User{}).Where("username = ?", username).Take(&user).Error
+	err = db.WithContext(ctx).Model(User{}).Where("business_id = ? AND username = ?", *businessId, username).Take(&user).Error
 	if err != nil {
 		return &result, errors.New("invalid username or password")
 	}
+	// users provisioned by the idp have no password of their own
+	if user.OidcProvisioned {
+		return &result, errors.New("invalid username or password")
+	}
 	err = utils.ComparePassword(user.Password, password)
 
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
+	if err != nil {
 		return &result, errors.New("invalid username or password")
 	}
 
+	return newLoginInfo(ctx, &user, nil)
+}
+
+// issue token & collect allowed modules for an authenticated user, or for a user impersonated by impersonator
+func newLoginInfo(ctx context.Context, user *User, impersonator *User) (*LoginInfo, error) {
+
+	db := config.GetDB()
+	var err error
+	var result LoginInfo
+
 	isActive := *user.IsActive
 	if !isActive {
 		return &result, errors.New("user is disabled")
 	}
-	token, err := utils.JwtGenerate(user.ID)
-	result.Token = token
 	result.UserId = user.ID
 	result.Name = user.Name
 	result.Username = user.Username
 	result.Email = user.Email
 	result.Phone = user.Phone
 	result.ImageUrl = user.ImageUrl
+	result.MustChangePassword = utils.GetPasswordPolicy().IsExpired(user.PasswordChangedAt)
 
-	if user.RoleId == 0 {
+	roleIds, err := GetActiveRoleIds(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(roleIds) == 0 {
 		return nil, errors.New("please assign role")
 	} else {
-		var userRole Role
-		if err := db.WithContext(ctx).Model(&Role{}).
-			Preload("RoleModules").Preload("RoleModules.Module").
-			Where("id = ?", user.RoleId).First(&userRole, user.RoleId).Error; err != nil {
+		var userRoles []*Role
+		if err := db.WithContext(ctx).Where("id IN ?", roleIds).Order("name").Find(&userRoles).Error; err != nil {
+			return nil, err
+		}
+		roleNames := make([]string, 0, len(userRoles))
+		for _, role := range userRoles {
+			roleNames = append(roleNames, role.Name)
+		}
+		result.Role = strings.Join(roleNames, ", ")
+
+		permissionVersion, err := GetUserPermissionVersion(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		claim := utils.JwtCustomClaim{
+			UserId:            user.ID,
+			BusinessId:        user.BusinessId,
+			RoleId:            user.RoleId,
+			Role:              result.Role,
+			PermissionVersion: permissionVersion,
+		}
+		if impersonator != nil {
+			claim.ImpersonatorId = impersonator.ID
+			result.IsImpersonated = true
+			result.ImpersonatedBy = impersonator.Username
+			// the support user doesn't have to change the user's password
+			result.MustChangePassword = false
+		}
+		result.Token, err = utils.JwtGenerate(claim)
+		if err != nil {
+			return nil, err
+		}
+
+		// union of the active roles' permissions, inherited ones included
+		permissions, err := GetPermissionsFromRoles(ctx, roleIds)
+		if err != nil {
+			return nil, err
+		}
+		modules, err := GetResources[Module](ctx, "name")
+		if err != nil {
 			return nil, err
 		}
-		result.Role = userRole.Name
 		var allowedModules []AllowedModule
-		for _, rm := range userRole.RoleModules {
-			allowedModules = append(allowedModules, AllowedModule{
-				ModuleName:     rm.Module.Name,
-				AllowedActions: rm.AllowedActions,
-			})
+		for _, module := range modules {
+			var actions []string
+			for _, action := range strings.Split(module.Actions, ";") {
+				if permissions[PermissionKey(module.Name, action)] {
+					actions = append(actions, action)
+				}
+			}
+			if len(actions) > 0 {
+				allowedModules = append(allowedModules, AllowedModule{
+					ModuleName:     module.Name,
+					AllowedActions: strings.Join(actions, ";"),
+				})
+			}
 		}
 		result.Modules = allowedModules
 	}
@@ -135,21 +277,57 @@ func Login(ctx context.Context, username string, password string) (*LoginInfo, e
 
 // destroy current session
 func Logout(ctx context.Context) (bool, error) {
-	token, ok := utils.GetTokenFromContext(ctx)
-	if !ok || token == "" {
+	claim, ok := utils.GetClaimFromContext(ctx)
+	if !ok {
 		return false, errors.New("token is required")
 	}
 
-	// Invalidate the token by storing it in Redis with an expiration
-	expiration := time.Hour // Match this with your JWT token's expiration time
-	err := config.SetRedisValue(token, "invalid", expiration)
-	if err != nil {
+	// Invalidate the token by its jti until it expires
+	if err := RevokeToken(ctx, claim); err != nil {
 		return false, err
 	}
 
 	return true, nil
 }
 
+// self sign up into the caller's business, else businessId or the only business
+// nobody is authenticated to grant roles
+func RegisterUser(ctx context.Context, input *NewUser, businessId *string) (*User, error) {
+	if len(input.RoleGrants) > 0 || input.RoleId != 0 {
+		return &User{}, errors.New("roles cannot be given on register")
+	}
+	if _, ok := utils.GetBusinessIdFromContext(ctx); !ok {
+		if businessId == nil || *businessId == "" {
+			defaultBusinessId, err := getDefaultBusinessId(ctx, config.GetDB())
+			if err != nil {
+				return &User{}, err
+			}
+			businessId = &defaultBusinessId
+		}
+		var count int64
+		if err := config.GetDB().WithContext(ctx).Model(&Business{}).Where("id = ?", *businessId).Count(&count).Error; err != nil {
+			return &User{}, err
+		}
+		if count == 0 {
+			return &User{}, errors.New("business not found")
+		}
+		ctx = utils.WithBusiness(ctx, *businessId)
+	}
+	return CreateUser(ctx, input)
+}
+
+// primary role given to a user, checked like role grants, 0 is none
+func validateUserRole(ctx context.Context, roleId int) error {
+	if roleId == 0 {
+		return nil
+	}
+	if err := utils.ValidateResourceId[Role](ctx, roleId); err != nil {
+		return errors.New("role not found")
+	}
+	// a caller can't give more than the caller's own roles
+	return ensureRoleWithinCaller(ctx, roleId)
+}
+
 func CreateUser(ctx context.Context, input *NewUser) (*User, error) {
 
 	db := config.GetDB()
@@ -159,7 +337,8 @@ func CreateUser(ctx context.Context, input *NewUser) (*User, error) {
 		return &User{}, errors.New("invalid email address")
 	}
 
-	err := db.WithContext(ctx).Model(&User{}).Where("username = ?", input.Username).Or("email = ?", input.Email).Count(&count).Error
+	// grouped, the tenant scope is ANDed to it
+	err := db.WithContext(ctx).Model(&User{}).Where("(username = ? OR email = ?)", input.Username, input.Email).Count(&count).Error
 	if err != nil {
 		return &User{}, err
 	}
@@ -167,11 +346,27 @@ func CreateUser(ctx context.Context, input *NewUser) (*User, error) {
 		return &User{}, errors.New("duplicate username or email")
 	}
 
+	policy := utils.GetPasswordPolicy()
+	if violations := policy.Check(input.Password, input.Username); len(violations) > 0 {
+		return &User{}, utils.NewPasswordPolicyError(violations)
+	}
+	if err := ensureBranchesWithinScope(ctx, input.BranchIds); err != nil {
+		return &User{}, err
+	}
+	grants, err := mapUserRoles(ctx, input.RoleGrants)
+	if err != nil {
+		return &User{}, err
+	}
+	if err := validateUserRole(ctx, input.RoleId); err != nil {
+		return &User{}, err
+	}
+
 	hashedPassword, err := utils.HashPassword(input.Password)
 	if err != nil {
 		return &User{}, err
 	}
 
+	passwordChangedAt := time.Now()
 	user := User{
 		Username:   html.EscapeString(strings.TrimSpace(input.Username)),
 		Name:       input.Name,
@@ -183,10 +378,34 @@ func CreateUser(ctx context.Context, input *NewUser) (*User, error) {
 		IsActive:   input.IsActive,
 		// Role:       input.Role,
 		RoleId:     input.RoleId,
+		PasswordChangedAt: &passwordChangedAt,
 	}
 
-	err = db.WithContext(ctx).Create(&user).Error
+	tx := db.Begin()
+	err = tx.WithContext(ctx).Create(&user).Error
 	if err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+	if err := storePasswordHistory(ctx, tx, user.ID, user.Password, policy.HistoryCount); err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+	if err := replaceUserBranches(ctx, tx, user.ID, input.BranchIds); err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+	if err := replaceUserRoles(ctx, tx, user.ID, grants); err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return &User{}, err
+	}
+	if err := clearUserRolesCache(user.ID); err != nil {
+		return &User{}, err
+	}
+	if err := utils.InvalidateRedis[User](ctx, user.ID); err != nil {
 		return &User{}, err
 	}
 	user.Password = ""
@@ -199,7 +418,7 @@ func UpdateUser(ctx context.Context, id int, input *NewUser) (*User, error) {
 	db := config.GetDB()
 	var count int64
 
-	err := db.Model(&User{}).Where("id = ?", id).Count(&count).Error
+	err := db.WithContext(ctx).Model(&User{}).Where("id = ?", id).Count(&count).Error
 	if err != nil {
 		return &User{}, err
 	}
@@ -207,8 +426,8 @@ func UpdateUser(ctx context.Context, id int, input *NewUser) (*User, error) {
 		return nil, errors.New("record not found")
 	}
 
-	if err = db.Model(&User{}).
-		Where("username = ? OR email = ?", input.Username, input.Email).
+	if err = db.WithContext(ctx).Model(&User{}).
+		Where("(username = ? OR email = ?)", input.Username, input.Email).
 		Not("id = ?", id).
 		Count(&count).Error; err != nil {
 		return nil, err
@@ -216,21 +435,61 @@ func UpdateUser(ctx context.Context, id int, input *NewUser) (*User, error) {
 	if count > 0 {
 		return &User{}, errors.New("duplicate email or username")
 	}
+	if err := ensureBranchesWithinScope(ctx, input.BranchIds); err != nil {
+		return nil, err
+	}
+	grants, err := mapUserRoles(ctx, input.RoleGrants)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateUserRole(ctx, input.RoleId); err != nil {
+		return nil, err
+	}
 
 	// db action
 	var user User
 	if err := db.WithContext(ctx).First(&user, id).Error; err != nil {
 		return nil, err
 	}
-	err = db.WithContext(ctx).Model(&user).Updates(map[string]interface{}{
+	updates := map[string]interface{}{
 		"Name": input.Name, 
 		"Email": input.Email, 
 		"Username": input.Username, 
 		"Phone": input.Phone, 
 		"Mobile": input.Mobile, 
 		"IsActive": input.IsActive,
-	}).Error
+	}
+	// the role is only changed when given
+	if input.RoleId != 0 {
+		updates["RoleId"] = input.RoleId
+	}
+	tx := db.Begin()
+	err = tx.WithContext(ctx).Model(&user).Updates(updates).Error
 	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	// branches are only replaced when given
+	if input.BranchIds != nil {
+		if err := replaceUserBranches(ctx, tx, id, input.BranchIds); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	// role grants are only replaced when given
+	if input.RoleGrants != nil {
+		if err := replaceUserRoles(ctx, tx, id, grants); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	if err := clearUserRolesCache(id); err != nil {
+		return nil, err
+	}
+	if err := utils.InvalidateRedis[User](ctx, id); err != nil {
 		return nil, err
 	}
 
@@ -248,10 +507,22 @@ func DeleteUser(ctx context.Context, id int) (*User, error) {
 		return nil, errors.New("record not found")
 	}
 
-	err = db.Delete(&user).Error
+	err = db.WithContext(ctx).Delete(&user).Error
 	if err != nil {
 		return &User{}, err
 	}
+	if err := db.WithContext(ctx).Where("user_id = ?", id).Delete(&UserBranch{}).Error; err != nil {
+		return &User{}, err
+	}
+	if err := db.WithContext(ctx).Where("user_id = ?", id).Delete(&UserRole{}).Error; err != nil {
+		return &User{}, err
+	}
+	if err := clearUserRolesCache(id); err != nil {
+		return &User{}, err
+	}
+	if err := utils.InvalidateRedis[User](ctx, id); err != nil {
+		return &User{}, err
+	}
 	return &user, nil
 }
 
@@ -271,6 +542,22 @@ func ChangePassword(ctx context.Context, oldPassword string, newPassword string)
 		return nil, errors.New("old password is wrong")
 	}
 
+	// check password policy & reuse of recent passwords
+	policy := utils.GetPasswordPolicy()
+	violations := policy.Check(newPassword, user.Username)
+	if err := utils.ComparePassword(user.Password, newPassword); err == nil {
+		violations = append(violations, utils.PasswordRuleViolation{Rule: "history", Message: "password was used recently"})
+	} else {
+		reused, err := checkPasswordHistory(ctx, db, user.ID, newPassword, policy.HistoryCount)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, reused...)
+	}
+	if len(violations) > 0 {
+		return nil, utils.NewPasswordPolicyError(violations)
+	}
+
 	//turn password into hash
 	hashedPassword, err := utils.HashPassword(newPassword)
 	if err != nil {
@@ -279,12 +566,26 @@ func ChangePassword(ctx context.Context, oldPassword string, newPassword string)
 	newPassword = string(hashedPassword)
 
 	tx := db.Begin()
-	if err := tx.WithContext(ctx).Model(&user).UpdateColumn("password", newPassword).Error; err != nil {
+	if err := tx.WithContext(ctx).Model(&user).UpdateColumns(map[string]interface{}{
+		"password":            newPassword,
+		"password_changed_at": time.Now(),
+	}).Error; err != nil {
 		tx.Rollback()
 		return nil, err
 	}
-	
-	return &user, tx.Commit().Error
+	if err := storePasswordHistory(ctx, tx, user.ID, newPassword, policy.HistoryCount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	user.PrepareGive()
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	if err := utils.InvalidateRedis[User](ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
 func GetUser(ctx context.Context, id int) (*User, error) {
@@ -303,63 +604,36 @@ func GetUser(ctx context.Context, id int) (*User, error) {
 	return &result, nil
 }
 
-func GetUsers(ctx context.Context,name *string, phone *string, mobile *string, email *string, isActive *bool) ([]*User, error) {
-
-	db := config.GetDB()
-	var results []*User
-
-	if name != nil && *name != "" {
-		db.Where("name LIKE ?", "%"+*name+"%")
-	}
-	if phone != nil && *phone != "" {
-		db.Where("phone LIKE ?", "%"+*phone+"%")
-	}
-	if mobile != nil && *mobile != "" {
-		db.Where("mobile LIKE ?", "%"+*mobile+"%")
-	}
-	if email != nil && *email != "" {
-		db.Where("email LIKE ?", "%"+*email+"%")
-	}
-	if isActive != nil {
-		db.Where("is_active = ?", isActive)
-	}
-
-	if err := db.WithContext(ctx).Find(&results).Error; err != nil {
-		return results, errors.New("no user")
-	}
+func GetUsers(ctx context.Context, filter *UserFilter) ([]*User, error) {
 
-	for i, u := range results {
-		u.Password = ""
-		results[i] = u
+	results, err := GetResourcesByFilter[User](ctx, filter, func(dbCtx *gorm.DB) *gorm.DB {
+		// passwords are never cached
+		return dbCtx.Omit("password")
+	})
+	if err != nil {
+		return nil, errors.New("no user")
 	}
 
 	return results, nil
 }
 
 
-func PaginateUser(ctx context.Context, limit *int, after *string,
-	name *string, phone *string, mobile *string, email *string, isActive *bool) (*UsersConnection, error) {
+func PaginateUser(ctx context.Context, args PageArgs, orderBy []*UserOrder, filter *UserFilter) (*UsersConnection, error) {
 	
 
 	db := config.GetDB()
+	dbCtx := db.WithContext(ctx).Omit("password")
 
-	if name != nil && *name != "" {
-		db.Where("name LIKE ?", "%"+*name+"%")
-	}
-	if phone != nil && *phone != "" {
-		db.Where("phone LIKE ?", "%"+*phone+"%")
-	}
-	if mobile != nil && *mobile != "" {
-		db.Where("mobile LIKE ?", "%"+*mobile+"%")
-	}
-	if email != nil && *email != "" {
-		db.Where("email LIKE ?", "%"+*email+"%")
-	}
-	if isActive != nil {
-		db.Where("is_active = ?", isActive)
+	dbCtx, err := applyFilter(ctx, dbCtx, filter)
+	if err != nil {
+		return nil, err
 	}
 
-	edges, pageInfo, err := FetchPageCompositeCursor[User](db, *limit, after, "created_at", ">")
+	orders, err := getPageOrders(ctx, orderBy, PageOrder{Column: "created_at"})
+	if err != nil {
+		return nil, err
+	}
+	edges, pageInfo, counter, err := FetchPage[User](dbCtx, args, orders...)
 	if err != nil {
 		return nil, err
 	}
@@ -367,6 +641,7 @@ func PaginateUser(ctx context.Context, limit *int, after *string,
 	var usersConnection UsersConnection
 
 	usersConnection.PageInfo = pageInfo
+	usersConnection.TotalCounter = counter
 	
 	for _, edge := range edges {
 		userEdge := UsersEdge(edge)
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"gorm.io/gorm"
+)
+
+// extra role granted to a user, open ended when ValidFrom or ValidUntil is nil
+type UserRole struct {
+	ID         int        `gorm:"primary_key" json:"id"`
+	UserId     int        `gorm:"index;not null" json:"user_id"`
+	RoleId     int        `gorm:"index;not null" json:"role_id"`
+	ValidFrom  *time.Time `gorm:"default:null" json:"valid_from"`
+	ValidUntil *time.Time `gorm:"default:null" json:"valid_until"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type NewUserRole struct {
+	RoleId     int        `json:"role_id"`
+	ValidFrom  *time.Time `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until"`
+}
+
+func (grant UserRole) isActiveAt(at time.Time) bool {
+	if grant.ValidFrom != nil && at.Before(*grant.ValidFrom) {
+		return false
+	}
+	if grant.ValidUntil != nil && !at.Before(*grant.ValidUntil) {
+		return false
+	}
+	return true
+}
+
+// whether the grant is in effect now
+func (grant UserRole) Active() bool {
+	return grant.isActiveAt(time.Now())
+}
+
+func userRolesKey(userId int) string {
+	return "Roles:User:" + fmt.Sprint(userId)
+}
+
+func mapUserRoles(ctx context.Context, input []*NewUserRole) ([]*UserRole, error) {
+
+	roleIds := make([]int, 0, len(input))
+	grants := make([]*UserRole, 0, len(input))
+	for _, grant := range input {
+		if grant.ValidFrom != nil && grant.ValidUntil != nil && !grant.ValidUntil.After(*grant.ValidFrom) {
+			return nil, errors.New("valid_until must be after valid_from")
+		}
+		roleIds = append(roleIds, grant.RoleId)
+		grants = append(grants, &UserRole{
+			RoleId:     grant.RoleId,
+			ValidFrom:  grant.ValidFrom,
+			ValidUntil: grant.ValidUntil,
+		})
+	}
+	if len(roleIds) > 0 {
+		if err := utils.ValidateResourcesId[Role](ctx, utils.UniqueSlice(roleIds)); err != nil {
+			return nil, errors.New("role not found")
+		}
+		// a caller can't grant more than the caller's own roles, themselves included
+		if err := ensureRolesWithinCaller(ctx, utils.UniqueSlice(roleIds)); err != nil {
+			return nil, err
+		}
+	}
+	return grants, nil
+}
+
+// full replace of user's role grants, cache is cleared by the caller after commit
+func replaceUserRoles(ctx context.Context, tx *gorm.DB, userId int, grants []*UserRole) error {
+	if err := tx.WithContext(ctx).Where("user_id = ?", userId).Delete(&UserRole{}).Error; err != nil {
+		return err
+	}
+	if len(grants) == 0 {
+		return nil
+	}
+	for _, grant := range grants {
+		grant.UserId = userId
+	}
+	return tx.WithContext(ctx).Create(&grants).Error
+}
+
+func clearUserRolesCache(userId int) error {
+	return config.RemoveRedisKey(userRolesKey(userId))
+}
+
+// retrieve user's role grants from redis or db, expired ones included
+func GetUserRoles(ctx context.Context, userId int) ([]*UserRole, error) {
+	key := userRolesKey(userId)
+	var grants []*UserRole
+	exists, err := config.GetRedisObject(key, &grants)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return grants, nil
+	}
+
+	db := config.GetDB()
+	if err := db.WithContext(ctx).Where("user_id = ?", userId).Order("id").Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	if err := config.SetRedisObject(key, &grants, 0); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// user's role & grants in effect now, checked on every request so expiries apply without re-login
+func GetActiveRoleIds(ctx context.Context, user *User) ([]int, error) {
+
+	grants, err := GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	roleIds := make([]int, 0, len(grants)+1)
+	if user.RoleId > 0 {
+		roleIds = append(roleIds, user.RoleId)
+	}
+	now := time.Now()
+	for _, grant := range grants {
+		if grant.isActiveAt(now) && !slices.Contains(roleIds, grant.RoleId) {
+			roleIds = append(roleIds, grant.RoleId)
+		}
+	}
+	return roleIds, nil
+}
+
+func GetUserActiveRoleIds(ctx context.Context, userId int) ([]int, error) {
+	user, err := GetUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return GetActiveRoleIds(ctx, user)
+}
+
+// hash over permission versions of every role the user holds, changes when a role or grant changes
+func GetUserPermissionVersion(ctx context.Context, user *User) (string, error) {
+
+	grants, err := GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+	roleIds := []int{user.RoleId}
+	for _, grant := range grants {
+		roleIds = append(roleIds, grant.RoleId)
+	}
+	roleIds = utils.UniqueSlice(roleIds)
+	slices.Sort(roleIds)
+
+	parts := make([]string, 0, len(roleIds))
+	for _, roleId := range roleIds {
+		version := 0
+		if roleId > 0 {
+			if version, err = GetRolePermissionVersion(ctx, roleId); err != nil {
+				return "", err
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%d.%d", roleId, version))
+	}
+	// grant windows are part of the version, activation & expiry are not
+	for _, grant := range grants {
+		parts = append(parts, fmt.Sprintf("%d:%d:%v:%v", grant.ID, grant.RoleId, grant.ValidFrom, grant.ValidUntil))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, ";")))
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// union of roles' permissions, keyed by PermissionKey
+func GetPermissionsFromRoles(ctx context.Context, roleIds []int) (map[string]bool, error) {
+	permissions := make(map[string]bool, 0)
+	for _, roleId := range roleIds {
+		rolePermissions, err := GetRolePermissions(ctx, roleId)
+		if err != nil {
+			return nil, err
+		}
+		for permission, allowed := range rolePermissions {
+			if allowed {
+				permissions[permission] = true
+			}
+		}
+	}
+	return permissions, nil
+}
+
+// least restrictive rule of the roles, a field visible to any role is visible
+func GetFieldRulesFromRoles(ctx context.Context, roleIds []int) (map[string]FieldAccess, error) {
+	rules := make(map[string]FieldAccess, 0)
+	for i, roleId := range roleIds {
+		roleRules, err := GetFieldRulesFromRole(ctx, roleId)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			for field, access := range roleRules {
+				rules[field] = access
+			}
+			continue
+		}
+		for field, access := range rules {
+			roleAccess, ok := roleRules[field]
+			if !ok {
+				delete(rules, field)
+			} else if roleAccess.rank() < access.rank() {
+				rules[field] = roleAccess
+			}
+		}
+	}
+	return rules, nil
+}
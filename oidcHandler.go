@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/aungmyozaw92/go-graphql/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// redirect to the identity provider, authorization code + PKCE
+func oidcLoginHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, err := utils.GetOidcClient(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+
+		url, err := client.AuthCodeURL()
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot start login"})
+			return
+		}
+		c.Redirect(http.StatusFound, url)
+	}
+}
+
+// exchange the code & return the same LoginInfo as the login mutation
+// a link started by the linkOidc mutation signs in the account it was linked to
+func oidcCallbackHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if errorCode := c.Query("error"); errorCode != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": errorCode, "error_description": c.Query("error_description")})
+			return
+		}
+
+		ctx := c.Request.Context()
+		client, err := utils.GetOidcClient(ctx)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+
+		identity, loginState, err := client.Exchange(ctx, c.Query("state"), c.Query("code"))
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var loginInfo *models.LoginInfo
+		if loginState.LinkUserId > 0 {
+			loginInfo, err = models.LinkOidc(ctx, identity, loginState.LinkUserId, loginState.BusinessId)
+		} else {
+			loginInfo, err = models.LoginWithOidc(ctx, identity, os.Getenv("OIDC_BUSINESS_ID"), utils.GetOidcGroupRoles(), os.Getenv("OIDC_DEFAULT_ROLE"))
+		}
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, loginInfo)
+	}
+}
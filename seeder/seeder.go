@@ -14,18 +14,58 @@ func SeedDatabase(tx *gorm.DB) {
 
 func ClearDatabase(tx *gorm.DB) error {
 	// Truncate or delete data in order of dependencies
+	// every business owned table, their business is removed below
+	if err := tx.Exec("DELETE FROM images").Error; err != nil {
+		return fmt.Errorf("error clearing images: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM products").Error; err != nil {
+		return fmt.Errorf("error clearing products: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM categories").Error; err != nil {
+		return fmt.Errorf("error clearing categories: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM units").Error; err != nil {
+		return fmt.Errorf("error clearing units: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM branches").Error; err != nil {
+		return fmt.Errorf("error clearing branches: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM api_keys").Error; err != nil {
+		return fmt.Errorf("error clearing api_keys: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM user_branches").Error; err != nil {
+		return fmt.Errorf("error clearing user_branches: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM field_permissions").Error; err != nil {
+		return fmt.Errorf("error clearing field_permissions: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM audit_logs").Error; err != nil {
+		return fmt.Errorf("error clearing audit_logs: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM user_roles").Error; err != nil {
+		return fmt.Errorf("error clearing user_roles: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM role_parents").Error; err != nil {
+		return fmt.Errorf("error clearing role_parents: %w", err)
+	}
 	if err := tx.Exec("DELETE FROM role_modules").Error; err != nil {
 		return fmt.Errorf("error clearing role_modules: %w", err)
 	}
 	if err := tx.Exec("DELETE FROM modules").Error; err != nil {
 		return fmt.Errorf("error clearing modules: %w", err)
 	}
+	if err := tx.Exec("DELETE FROM password_histories").Error; err != nil {
+		return fmt.Errorf("error clearing password_histories: %w", err)
+	}
 	if err := tx.Exec("DELETE FROM users").Error; err != nil {
 		return fmt.Errorf("error clearing users: %w", err)
 	}
 	if err := tx.Exec("DELETE FROM roles").Error; err != nil {
 		return fmt.Errorf("error clearing roles: %w", err)
 	}
+	if err := tx.Exec("DELETE FROM businesses").Error; err != nil {
+		return fmt.Errorf("error clearing businesses: %w", err)
+	}
 	
 	fmt.Println("Database tables cleared")
 	return nil
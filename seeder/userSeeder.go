@@ -2,6 +2,7 @@ package seeder
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/aungmyozaw92/go-graphql/models"
 	"github.com/aungmyozaw92/go-graphql/utils"
@@ -10,37 +11,21 @@ import (
 
 func seedUser(tx *gorm.DB) {
 
-	// // Seed Roles
-
-	role, err := models.CreateDefaultRole(tx)
-	if err != nil {
+	// create modules from the registry
+	if _, err := models.SyncModules(tx); err != nil {
 		tx.Rollback()
-		fmt.Println("Err CreateDefaultRole: " + err.Error())
+		fmt.Println("Error SyncModules: " + err.Error())
 		return
 	}
 
-	// create modules for 
-	modules, err := models.CreateDefaultModules(tx)
+	// // Seed Business & Admin role
+	business, role, err := models.CreateBusiness(tx, "Default")
 	if err != nil {
 		tx.Rollback()
-		fmt.Println("Error CreateDefaultModules: " + err.Error())
+		fmt.Println("Error CreateBusiness: " + err.Error())
 		return
 	}
 
-	// gives permission to owner
-	for _, module := range modules {
-		roleModule := models.RoleModule{
-			RoleId:         role.ID,
-			ModuleId:       module.ID,
-			AllowedActions: module.Actions,
-		}
-		if err := tx.Create(&roleModule).Error; err != nil {
-			tx.Rollback()
-			fmt.Println("Error seeding role modules: " + err.Error())
-			return
-		}
-	}
-
 
 	// Seed Users
 	hashedPassword, err := utils.HashPassword("admin123")
@@ -50,14 +35,17 @@ func seedUser(tx *gorm.DB) {
 		return
 	}
 
+	passwordChangedAt := time.Now()
 	users := []models.User{
 		{
+			BusinessId: business.ID,
 			Username: "super_admin",
 			Name:     "SuperAdmin",
 			Email:    "superadmin@example.com",
 			RoleId:  role.ID,
 			IsActive: utils.NewTrue(),
 			Password: string(hashedPassword),
+			PasswordChangedAt: &passwordChangedAt,
 		},
 	}
 
@@ -2,10 +2,11 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
@@ -18,66 +19,42 @@ import (
 	"github.com/aungmyozaw92/go-graphql/graph"
 	"github.com/aungmyozaw92/go-graphql/middlewares"
 	"github.com/aungmyozaw92/go-graphql/models"
+	"github.com/aungmyozaw92/go-graphql/utils"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/ravilushqa/otelgqlgen"
-	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
 )
 
 const defaultPort = "8080"
 
 var tracer = otel.Tracer("go-graphql")
 
+// APQ store on the configured cache
 type Cache struct {
-	client redis.UniversalClient
-	ttl    time.Duration
+	cache config.Cache
+	ttl   time.Duration
 }
 
 const apqPrefix = "apq:"
 
-func getRedisClient(redisAddress string) *redis.Client {
-	client := redis.NewClient(&redis.Options{
-		Addr: redisAddress,
-	})
-	return client
-}
-
-func NewCache(redisAddress string, ttl time.Duration) (*Cache, error) {
-
-	client := getRedisClient(redisAddress)
-
-	err := client.Ping(context.Background()).Err()
-	if err != nil {
-		return nil, fmt.Errorf("could not create cache: %w", err)
-	}
-
-	return &Cache{client: client, ttl: ttl}, nil
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{cache: config.GetCache(), ttl: ttl}
 }
 
-// func (c *Cache) Add(ctx context.Context, key string, value interface{}) {
-// 	c.client.Set(context.Background(), apqPrefix+key, value, c.ttl)
-// }
-
-// func (c *Cache) Get(ctx context.Context, key string) (interface{}, bool) {
-// 	s, err := c.client.Get(context.Background(), apqPrefix+key).Result()
-// 	if err != nil {
-// 		return struct{}{}, false
-// 	}
-// 	return s, true
-// }
-
+// a failed add only means the client resends the full query
 func (c *Cache) Add(ctx context.Context, key string, value string) {
-	c.client.Set(context.Background(), apqPrefix+key, value, c.ttl)
+	c.cache.Set(context.Background(), apqPrefix+key, value, c.ttl)
 }
 
 func (c *Cache) Get(ctx context.Context, key string) (string, bool) {
-	s, err := c.client.Get(context.Background(), apqPrefix+key).Result()
+	s, exists, err := c.cache.Get(context.Background(), apqPrefix+key)
 	if err != nil {
 		return "", false
 	}
-	return s, true
+	return s, exists
 }
 
 // Defining the Graphql handler
@@ -85,15 +62,13 @@ func graphqlHandler() gin.HandlerFunc {
 	// NewExecutableSchema and Config are in the generated.go file
 	// Resolver is in the resolver.go file
 
-	cache, err := NewCache(os.Getenv("REDIS_ADDRESS"), 24*time.Hour)
-	if err != nil {
-		panic("cannot create APQ redis cache")
-	}
+	cache := NewCache(24 * time.Hour)
 
 	c := graph.Config{Resolvers: &graph.Resolver{
 		Tracer: tracer,
 	}}
 	c.Directives.Auth = directives.Auth
+	c.Directives.HasPermission = directives.HasPermission
 
 	h := handler.NewDefaultServer(graph.NewExecutableSchema(c))
 	h.Use(otelgqlgen.Middleware())
@@ -103,11 +78,22 @@ func graphqlHandler() gin.HandlerFunc {
 		MaxUploadSize: 50 << 20, // 50 MB
 	})
 	h.Use(extension.AutomaticPersistedQuery{Cache: cache})
+	h.AroundOperations(directives.FieldPermissionOperation)
+	h.AroundOperations(directives.AuditOperation)
+	h.AroundFields(directives.FieldPermissionField)
 	return func(c *gin.Context) {
 		h.ServeHTTP(c.Writer, c.Request)
 	}
 }
 
+// Publishing the JWT verification keys
+func jwksHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, utils.GetJwks())
+	}
+}
+
 // Defining the Playground handler
 func playgroundHandler() gin.HandlerFunc {
 	h := playground.Handler("GraphQL", "/query")
@@ -128,18 +114,56 @@ func main() {
 
 	logger := config.GetLogger()
 
+	// refuse to start without a signing key
+	if err := utils.LoadJwtKeys(); err != nil {
+		log.Fatalf("cannot load jwt keys: %v", err)
+	}
+
 	// Connect to Database
 	db := config.GetDB()
 	sqlDB, _ := db.DB()
 	defer sqlDB.Close()
 	models.MigrateTable()
+	// modules & actions are declared in code
+	if err := graph.ValidatePermissionDirectives(); err != nil {
+		log.Fatalf("invalid permission directive: %v", err)
+	}
+	var syncReport *models.ModuleSyncReport
+	if err := db.Transaction(func(tx *gorm.DB) (err error) {
+		syncReport, err = models.SyncModules(tx)
+		return err
+	}); err != nil {
+		log.Fatalf("cannot sync modules: %v", err)
+	}
+	if err := utils.ClearPermissionsCache(syncReport.ChangedRoleIds...); err != nil {
+		log.Fatalf("cannot clear permissions cache: %v", err)
+	}
+	if len(syncReport.OrphanModules) > 0 || len(syncReport.OrphanActions) > 0 {
+		logger.Warn(syncReport.String())
+	}
+	if err := models.RegisterTenantScope(db); err != nil {
+		log.Fatalf("cannot register tenant scope: %v", err)
+	}
+	if err := models.RegisterBranchScope(db); err != nil {
+		log.Fatalf("cannot register branch scope: %v", err)
+	}
+	if err := models.RegisterAuditLog(db); err != nil {
+		log.Fatalf("cannot register audit log: %v", err)
+	}
+	// each replica keeps its own search index, in sync with the others' changes
+	go models.SubscribeProductIndex(context.Background())
 	// Initialize Gin router.
 	r := gin.New()
+	// X-Forwarded-For is only believed from these proxies, otherwise the client ip is the peer's,
+	// so allowedIps of api keys can't be spoofed
+	if err := r.SetTrustedProxies(getTrustedProxies()); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowAllOrigins = true
 	corsConfig.AddAllowMethods("GET", "POST", "PUT", "DELETE", "OPTIONS")
-	corsConfig.AddAllowHeaders("token", "Origin", "Content-Type", "Authorization")
+	corsConfig.AddAllowHeaders("token", "Origin", "Content-Type", "Authorization", "X-API-Key")
 	corsConfig.AddExposeHeaders("Content-Length")
 	corsConfig.AllowCredentials = true
 
@@ -150,6 +174,13 @@ func main() {
 	r.Use(gin.Recovery())
 	r.POST("/query", graphqlHandler())
 	r.GET("/", playgroundHandler())
+	r.GET("/.well-known/jwks.json", jwksHandler())
+	r.GET("/auth/oidc/login", oidcLoginHandler())
+	r.GET("/auth/oidc/callback", oidcCallbackHandler())
+	// cache hit ratios & runtime stats, off unless asked for
+	if os.Getenv("METRICS_ENABLED") == "true" {
+		r.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	}
 	
 	r.NoRoute(customNotFoundHandler)
 	r.Run(":" + port)
@@ -160,6 +191,17 @@ func main() {
 	log.Println("Server started successfully")
 }
 
+// ips or CIDR ranges in TRUSTED_PROXIES, comma separated, none by default
+func getTrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 // customErrorLogger is a custom Gin middleware that logs only errors
 func customErrorLogger(logger *logrus.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+)
+
+const apiKeyScheme = "gk_"
+
+// returns the full key shown once to the client, lookup prefix & hashed secret to store
+func GenerateApiKey() (key string, prefix string, secretHash string, err error) {
+	prefixBytes := make([]byte, 4)
+	if _, err = rand.Read(prefixBytes); err != nil {
+		return "", "", "", err
+	}
+	secretBytes := make([]byte, 32)
+	if _, err = rand.Read(secretBytes); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+	return apiKeyScheme + prefix + "." + secret, prefix, HashApiKeySecret(secret), nil
+}
+
+// split gk_<prefix>.<secret>
+func ParseApiKey(key string) (prefix string, secret string, err error) {
+	rest, found := strings.CutPrefix(key, apiKeyScheme)
+	if !found {
+		return "", "", errors.New("invalid api key")
+	}
+	prefix, secret, found = strings.Cut(rest, ".")
+	if !found || prefix == "" || secret == "" {
+		return "", "", errors.New("invalid api key")
+	}
+	return prefix, secret, nil
+}
+
+func HashApiKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func CompareApiKeySecret(secretHash string, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(secretHash), []byte(HashApiKeySecret(secret))) == 1
+}
+
+// validate allowlist entries, each must be an ip or cidr
+func ValidateIpAllowlist(entries []string) error {
+	for _, entry := range entries {
+		if _, _, err := net.ParseCIDR(entry); err == nil {
+			continue
+		}
+		if net.ParseIP(entry) == nil {
+			return errors.New("invalid ip address " + entry)
+		}
+	}
+	return nil
+}
+
+// empty allowlist allows any ip
+func IsIpAllowed(entries []string, ip string) bool {
+	if len(entries) == 0 {
+		return true
+	}
+	clientIp := net.ParseIP(ip)
+	if clientIp == nil {
+		return false
+	}
+	for _, entry := range entries {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(clientIp) {
+				return true
+			}
+			continue
+		}
+		if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(clientIp) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// branches the caller may see, resolved lazily once per request
+type BranchScope struct {
+	resolve   func() (bool, []int, error)
+	once      sync.Once
+	all       bool
+	branchIds []int
+	err       error
+}
+
+// resolve returns whether every branch is allowed, otherwise the allowed branch ids
+func NewBranchScope(resolve func() (bool, []int, error)) *BranchScope {
+	return &BranchScope{resolve: resolve}
+}
+
+func (s *BranchScope) Resolve() (bool, []int, error) {
+	s.once.Do(func() {
+		s.all, s.branchIds, s.err = s.resolve()
+	})
+	return s.all, s.branchIds, s.err
+}
+
+func (s *BranchScope) Allows(branchId int) (bool, error) {
+	all, branchIds, err := s.Resolve()
+	if err != nil {
+		return false, err
+	}
+	return all || slices.Contains(branchIds, branchId), nil
+}
+
+// nil when the request is not branch scoped (cli, seeder, internal lookups)
+func GetBranchScopeFromContext(ctx context.Context) *BranchScope {
+	val, _ := ctx.Value(ContextKeyBranchScope).(*BranchScope)
+	return val
+}
+
+// for queries that must see every branch, e.g. filling the shared cache
+func WithoutBranchScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ContextKeyBranchScope, (*BranchScope)(nil))
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"golang.org/x/sync/singleflight"
+)
+
+// how long a rebuild holds the key's lock, waiters give up after it
+const cacheLockLifespan = 10 * time.Second
+
+const cacheLockPollInterval = 50 * time.Millisecond
+
+// rebuilds of a key within this process
+var cacheGroup singleflight.Group
+
+// cached value, served as is until StaleAt then served while it's rebuilt
+type cacheEnvelope[V any] struct {
+	Value   V     `json:"value"`
+	StaleAt int64 `json:"stale_at"`
+}
+
+func (envelope cacheEnvelope[V]) stale() bool {
+	return time.Now().UnixMilli() >= envelope.StaleAt
+}
+
+// CACHE_LIFESPAN ±10%, so keys stored together don't expire together
+func getJitteredLifespan() time.Duration {
+	lifespan := GetCacheLifespan()
+	jitter := time.Duration(rand.Int63n(int64(lifespan)/5+1)) - lifespan/10
+	return lifespan + jitter
+}
+
+func getCached[V any](key string) (envelope cacheEnvelope[V], exists bool, err error) {
+	exists, err = config.GetRedisObject(key, &envelope)
+	return envelope, exists, err
+}
+
+// stale after the jittered lifespan, kept for a quarter of it more to be served while rebuilt
+// tagged before it's stored, so an invalidation in between can't leave it behind
+func storeCached[V any](key string, value V, tags ...string) error {
+	lifespan := getJitteredLifespan()
+	envelope := cacheEnvelope[V]{
+		Value:   value,
+		StaleAt: time.Now().Add(lifespan).UnixMilli(),
+	}
+	exp := lifespan + lifespan/4
+	if err := config.TagRedisKey(key, exp, tags...); err != nil {
+		return err
+	}
+	return config.SetRedisObject(key, &envelope, exp)
+}
+
+// value of key, load rebuilds it once at a time across processes
+// a stale value is returned right away & rebuilt in the background
+// versionKey is the counter bumped when the value is invalidated, empty if there's none
+func loadCached[V any](ctx context.Context, key string, versionKey string, tags []string, load func(ctx context.Context) (V, error)) (V, error) {
+	envelope, exists, err := getCached[V](key)
+	if err == nil && exists {
+		if envelope.stale() {
+			// the request may finish before the rebuild does
+			refreshCtx := context.WithoutCancel(ctx)
+			cacheGroup.DoChan("refresh:"+key, func() (any, error) {
+				return rebuildCached(refreshCtx, key, versionKey, tags, load, false)
+			})
+		}
+		return envelope.Value, nil
+	}
+
+	value, err, _ := cacheGroup.Do(key, func() (any, error) {
+		return rebuildCached(context.WithoutCancel(ctx), key, versionKey, tags, load, true)
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return value.(V), nil
+}
+
+// load & store key while holding its lock, if another process holds it
+// wait for its value, or leave it to them when there's a stale value to serve
+func rebuildCached[V any](ctx context.Context, key string, versionKey string, tags []string, load func(ctx context.Context) (V, error), wait bool) (V, error) {
+	var zero V
+	release, obtained := config.ObtainCacheLock(ctx, key, cacheLockLifespan)
+	defer release()
+
+	if !obtained {
+		if !wait {
+			return zero, nil
+		}
+		for deadline := time.Now().Add(cacheLockLifespan); time.Now().Before(deadline); {
+			time.Sleep(cacheLockPollInterval)
+			if envelope, exists, err := getCached[V](key); err == nil && exists {
+				return envelope.Value, nil
+			}
+		}
+		// the holder is slow or gone, load it ourselves
+	} else if envelope, exists, err := getCached[V](key); err == nil && exists && !envelope.stale() {
+		// rebuilt by the previous holder
+		return envelope.Value, nil
+	}
+
+	version := getCacheVersion(versionKey)
+	value, err := load(ctx)
+	if err != nil {
+		return zero, err
+	}
+	// invalidated while loading, the value may predate the change, the next read rebuilds it
+	if getCacheVersion(versionKey) != version {
+		return value, nil
+	}
+	// the cache is best effort
+	storeCached(key, value, tags...)
+	return value, nil
+}
+
+// value of versionKey, empty if it's missing or there's none
+func getCacheVersion(versionKey string) string {
+	if versionKey == "" {
+		return ""
+	}
+	version, _, _ := config.GetRedisValue(versionKey)
+	return version
+}
+
+// get instance of id from the cache, load is called on a miss
+func LoadRedis[T any](ctx context.Context, id int, load func(ctx context.Context) (*T, error)) (*T, error) {
+	key, ok := redisKey[T](ctx, GetTypeName[T]()+":"+fmt.Sprint(id))
+	if !ok {
+		return load(ctx)
+	}
+	versionKey, _ := redisVersionKey[T](ctx)
+	return loadCached(ctx, key, versionKey, RedisTags[T](ctx, id), load)
+}
+
+// get list of ctx's business from the cache, load is called on a miss
+func LoadRedisList[T any](ctx context.Context, load func(ctx context.Context) ([]*T, error)) ([]*T, error) {
+	key, ok := redisKey[T](ctx, GetTypeName[T]()+"List")
+	if !ok {
+		return load(ctx)
+	}
+	versionKey, _ := redisVersionKey[T](ctx)
+	return loadCached(ctx, key, versionKey, RedisTags[T](ctx), load)
+}
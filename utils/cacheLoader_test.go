@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+)
+
+// not owned by a business, so it's cached without one in ctx
+type cachedThing struct {
+	ID   int
+	Name string
+}
+
+type cachedUnit struct {
+	ID int
+}
+
+func TestLoadRedisSkipsRebuildsRacingAnInvalidation(t *testing.T) {
+	tests := []struct {
+		name string
+		// called while the value is loaded from the database
+		during     func(ctx context.Context) error
+		wantStored bool
+	}{
+		{name: "stored", during: func(ctx context.Context) error { return nil }, wantStored: true},
+		{
+			name:       "invalidated while loading",
+			during:     func(ctx context.Context) error { return InvalidateRedis[cachedThing](ctx, 1) },
+			wantStored: false,
+		},
+		{
+			name:       "another type invalidated while loading",
+			during:     func(ctx context.Context) error { return InvalidateRedis[cachedUnit](ctx, 1) },
+			wantStored: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			config.SetCache(config.NewMemoryCache(100))
+
+			loaded, err := LoadRedis[cachedThing](ctx, 1, func(ctx context.Context) (*cachedThing, error) {
+				if err := tt.during(ctx); err != nil {
+					return nil, err
+				}
+				return &cachedThing{ID: 1, Name: "loaded"}, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Name != "loaded" {
+				t.Errorf("LoadRedis() = %+v, want the loaded value", loaded)
+			}
+
+			stored, err := GetRedis[cachedThing](ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (stored != nil) != tt.wantStored {
+				t.Errorf("GetRedis() = %+v, want stored %v", stored, tt.wantStored)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"errors"
 )
 
 type contextKey string
@@ -14,8 +15,51 @@ var (
 	ContextKeyToken      = contextKey("Token")
 	ContextKeyUsername   = contextKey("Username")
 	ContextKeyUserId     = contextKey("UserId")
+	ContextKeyClaim      = contextKey("Claim")
+	ContextKeyApiKeyId   = contextKey("ApiKeyId")
+	ContextKeyBranchScope = contextKey("BranchScope")
+	ContextKeyBusinessId  = contextKey("BusinessId")
+	ContextKeyAuditOperation = contextKey("AuditOperation")
+	ContextKeyImpersonatorId = contextKey("ImpersonatorId")
+	ContextKeyWithoutTenant  = contextKey("WithoutTenant")
 )
 
+// business owned data was reached without a business, nor WithoutTenant
+var ErrNoTenant = errors.New("business is required")
+
+func GetApiKeyIdFromContext(ctx context.Context) (int, bool) {
+	val, ok := ctx.Value(ContextKeyApiKeyId).(int)
+	return val, ok
+}
+
+// tenant of the request, absent for system & not yet authenticated requests
+func GetBusinessIdFromContext(ctx context.Context) (string, bool) {
+	val, ok := ctx.Value(ContextKeyBusinessId).(string)
+	return val, ok && val != ""
+}
+
+func WithBusiness(ctx context.Context, businessId string) context.Context {
+	return context.WithValue(ctx, ContextKeyBusinessId, businessId)
+}
+
+// for system queries across every business, e.g. roles using a shared module
+// without it, business owned data can't be reached from a ctx with no business
+func WithoutTenant(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, ContextKeyBusinessId, "")
+	return context.WithValue(ctx, ContextKeyWithoutTenant, true)
+}
+
+// whether ctx was made by WithoutTenant
+func IsWithoutTenant(ctx context.Context) bool {
+	val, _ := ctx.Value(ContextKeyWithoutTenant).(bool)
+	return val
+}
+
+func GetClaimFromContext(ctx context.Context) (*JwtCustomClaim, bool) {
+	val, ok := ctx.Value(ContextKeyClaim).(*JwtCustomClaim)
+	return val, ok && val != nil
+}
+
 func GetTokenFromContext(ctx context.Context) (string, bool) {
 	val, ok := ctx.Value(ContextKeyToken).(string)
 	return val, ok
@@ -26,6 +70,12 @@ func GetUserIdFromContext(ctx context.Context) (int, bool) {
 	return val, ok
 }
 
+// real user behind an impersonation token
+func GetImpersonatorIdFromContext(ctx context.Context) (int, bool) {
+	val, ok := ctx.Value(ContextKeyImpersonatorId).(int)
+	return val, ok && val > 0
+}
+
 func GetUsernameFromContext(ctx context.Context) (string, bool) {
 	val, ok := ctx.Value(ContextKeyUsername).(string)
 	return val, ok
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const oidcStatePrefix = "OidcState:"
+const oidcStateLifespan = 10 * time.Minute
+
+type OidcClient struct {
+	Provider     *oidc.Provider
+	OAuth2Config oauth2.Config
+	Verifier     *oidc.IDTokenVerifier
+	GroupsClaim  string
+}
+
+// pkce verifier & nonce of a pending login, keyed by state
+type OidcLoginState struct {
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	// set when a signed in user links the identity to their account
+	LinkUserId int    `json:"link_user_id,omitempty"`
+	BusinessId string `json:"business_id,omitempty"`
+}
+
+// claims read from the id token
+type OidcIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+	Groups        []string
+}
+
+var (
+	oidcClient *OidcClient
+	oidcMutex  sync.Mutex
+)
+
+func IsOidcEnabled() bool {
+	return os.Getenv("OIDC_ISSUER_URL") != ""
+}
+
+// discover provider on first use, retried until it succeeds
+func GetOidcClient(ctx context.Context) (*OidcClient, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	if oidcClient != nil {
+		return oidcClient, nil
+	}
+	if !IsOidcEnabled() {
+		return nil, errors.New("oidc is not configured")
+	}
+
+	provider, err := oidc.NewProvider(ctx, os.Getenv("OIDC_ISSUER_URL"))
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []string{oidc.ScopeOpenID, "profile", "email"}
+	if extra := os.Getenv("OIDC_SCOPES"); extra != "" {
+		scopes = append(scopes, strings.Split(extra, ",")...)
+	}
+	groupsClaim := os.Getenv("OIDC_GROUPS_CLAIM")
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	clientId := os.Getenv("OIDC_CLIENT_ID")
+	oidcClient = &OidcClient{
+		Provider: provider,
+		OAuth2Config: oauth2.Config{
+			ClientID:     clientId,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			Endpoint:     provider.Endpoint(),
+			Scopes:       UniqueSlice(scopes),
+		},
+		Verifier:    provider.Verifier(&oidc.Config{ClientID: clientId}),
+		GroupsClaim: groupsClaim,
+	}
+	return oidcClient, nil
+}
+
+// idp group => role name, configured as OIDC_GROUP_ROLES="group=Role;group2=Role2", first match wins
+func GetOidcGroupRoles() [][2]string {
+	var mapping [][2]string
+	for _, pair := range strings.Split(os.Getenv("OIDC_GROUP_ROLES"), ";") {
+		group, role, found := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if found && group != "" && role != "" {
+			mapping = append(mapping, [2]string{group, role})
+		}
+	}
+	return mapping
+}
+
+// hash of a random secret nobody knows, for users who only sign in through the idp
+func UnusablePasswordHash() ([]byte, error) {
+	secret, err := randomUrlString(32)
+	if err != nil {
+		return nil, err
+	}
+	return HashPassword(secret)
+}
+
+func randomUrlString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// authorization url with pkce challenge, state is kept in redis until the callback
+func (client *OidcClient) AuthCodeURL() (string, error) {
+	return client.authCodeURL(OidcLoginState{})
+}
+
+// authorization url whose callback links the identity to userId of businessId
+func (client *OidcClient) LinkCodeURL(userId int, businessId string) (string, error) {
+	return client.authCodeURL(OidcLoginState{LinkUserId: userId, BusinessId: businessId})
+}
+
+func (client *OidcClient) authCodeURL(loginState OidcLoginState) (string, error) {
+	state, err := randomUrlString(24)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomUrlString(24)
+	if err != nil {
+		return "", err
+	}
+	loginState.CodeVerifier = oauth2.GenerateVerifier()
+	loginState.Nonce = nonce
+	if err := config.SetRedisObject(oidcStatePrefix+state, &loginState, oidcStateLifespan); err != nil {
+		return "", err
+	}
+
+	return client.OAuth2Config.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(loginState.CodeVerifier),
+		oidc.Nonce(loginState.Nonce),
+	), nil
+}
+
+// exchange code, verify id token & nonce, state can only be used once
+// the state is returned with the identity, e.g. to tell a link from a login
+func (client *OidcClient) Exchange(ctx context.Context, state string, code string) (*OidcIdentity, *OidcLoginState, error) {
+	var loginState OidcLoginState
+	exists, err := config.GetRedisObject(oidcStatePrefix+state, &loginState)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exists {
+		return nil, nil, errors.New("invalid or expired state")
+	}
+	if err := config.RemoveRedisKey(oidcStatePrefix + state); err != nil {
+		return nil, nil, err
+	}
+
+	token, err := client.OAuth2Config.Exchange(ctx, code, oauth2.VerifierOption(loginState.CodeVerifier))
+	if err != nil {
+		return nil, nil, err
+	}
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, nil, errors.New("id_token is missing")
+	}
+	idToken, err := client.Verifier.Verify(ctx, rawIdToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if idToken.Nonce != loginState.Nonce {
+		return nil, nil, errors.New("invalid nonce")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, nil, err
+	}
+
+	identity := OidcIdentity{
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+	}
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.Name, _ = claims["name"].(string)
+	identity.Username, _ = claims["preferred_username"].(string)
+	switch groups := claims[client.GroupsClaim].(type) {
+	case []interface{}:
+		for _, group := range groups {
+			if g, ok := group.(string); ok {
+				identity.Groups = append(identity.Groups, g)
+			}
+		}
+	case string:
+		identity.Groups = strings.Split(groups, ",")
+	}
+
+	return &identity, &loginState, nil
+}
@@ -0,0 +1,306 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const mockIdpClientId = "go-graphql"
+
+// identity provider serving discovery, jwks & token endpoints
+type mockIdp struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu sync.Mutex
+	// code => pkce challenge & nonce of the authorization request
+	codes map[string][2]string
+	// signs the id token, key unless a test replaces it
+	signingKey *rsa.PrivateKey
+	// changes the id token claims
+	claims func(claims jwt.MapClaims)
+}
+
+func newMockIdp(t *testing.T) *mockIdp {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdp{key: key, signingKey: key, codes: make(map[string][2]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// what the user agent does at the idp: returns the code sent back to the callback with state
+func (idp *mockIdp) authorize(t *testing.T, authUrl string) (state string, code string) {
+	t.Helper()
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization url without pkce: %s", authUrl)
+	}
+	code = "code-" + query.Get("state")
+	idp.mu.Lock()
+	idp.codes[code] = [2]string{query.Get("code_challenge"), query.Get("nonce")}
+	idp.mu.Unlock()
+	return query.Get("state"), code
+}
+
+func (idp *mockIdp) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idp.mu.Lock()
+	request, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	verifierHash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifierHash[:]) != request[0] {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":                idp.server.URL,
+		"sub":                "subject-1",
+		"aud":                mockIdpClientId,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              request[1],
+		"email":              "Jane@Example.com",
+		"email_verified":     true,
+		"name":               "Jane",
+		"preferred_username": "jane",
+		"groups":             []string{"erp-admins", "staff"},
+	}
+	if idp.claims != nil {
+		idp.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(idp.signingKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func TestOidcExchange(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// changes the idp before the login
+		setup func(idp *mockIdp)
+		// changes the state or code sent to the callback
+		callback func(state, code string) (string, string)
+		link     bool
+		wantErr  string
+	}{
+		{name: "login"},
+		{name: "link", link: true},
+		{
+			name: "unknown state",
+			callback: func(state, code string) (string, string) {
+				return "unknown", code
+			},
+			wantErr: "invalid or expired state",
+		},
+		{
+			name: "code of another login",
+			callback: func(state, code string) (string, string) {
+				return state, "code-unknown"
+			},
+			wantErr: "invalid_grant",
+		},
+		{
+			name: "nonce of another login",
+			setup: func(idp *mockIdp) {
+				idp.claims = func(claims jwt.MapClaims) { claims["nonce"] = "replayed" }
+			},
+			wantErr: "invalid nonce",
+		},
+		{
+			name: "token of another client",
+			setup: func(idp *mockIdp) {
+				idp.claims = func(claims jwt.MapClaims) { claims["aud"] = "another-client" }
+			},
+			wantErr: "audience",
+		},
+		{
+			name: "expired token",
+			setup: func(idp *mockIdp) {
+				idp.claims = func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }
+			},
+			wantErr: "expired",
+		},
+		{
+			name: "token signed by another key",
+			setup: func(idp *mockIdp) {
+				idp.signingKey = otherKey
+			},
+			wantErr: "signature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			idp := newMockIdp(t)
+			if tt.setup != nil {
+				tt.setup(idp)
+			}
+			config.SetCache(config.NewMemoryCache(100))
+			t.Setenv("OIDC_ISSUER_URL", idp.server.URL)
+			t.Setenv("OIDC_CLIENT_ID", mockIdpClientId)
+			t.Setenv("OIDC_REDIRECT_URL", "http://localhost/auth/oidc/callback")
+			oidcClient = nil
+			t.Cleanup(func() { oidcClient = nil })
+
+			client, err := GetOidcClient(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var authUrl string
+			if tt.link {
+				authUrl, err = client.LinkCodeURL(7, "business-1")
+			} else {
+				authUrl, err = client.AuthCodeURL()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			state, code := idp.authorize(t, authUrl)
+			if tt.callback != nil {
+				state, code = tt.callback(state, code)
+			}
+			identity, loginState, err := client.Exchange(ctx, state, code)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Exchange() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+
+			if identity.Issuer != idp.server.URL || identity.Subject != "subject-1" {
+				t.Errorf("identity = %s %s, want %s subject-1", identity.Issuer, identity.Subject, idp.server.URL)
+			}
+			if identity.Email != "Jane@Example.com" || !identity.EmailVerified || identity.Username != "jane" || identity.Name != "Jane" {
+				t.Errorf("identity claims = %+v", identity)
+			}
+			if strings.Join(identity.Groups, ",") != "erp-admins,staff" {
+				t.Errorf("identity groups = %v", identity.Groups)
+			}
+			wantUserId, wantBusinessId := 0, ""
+			if tt.link {
+				wantUserId, wantBusinessId = 7, "business-1"
+			}
+			if loginState.LinkUserId != wantUserId || loginState.BusinessId != wantBusinessId {
+				t.Errorf("login state links %d of %q, want %d of %q", loginState.LinkUserId, loginState.BusinessId, wantUserId, wantBusinessId)
+			}
+
+			// state can only be used once
+			if _, _, err := client.Exchange(ctx, state, code); err == nil {
+				t.Error("Exchange() with a used state succeeded")
+			}
+		})
+	}
+}
+
+func TestGetOidcGroupRoles(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  [][2]string
+	}{
+		{name: "empty", value: "", want: nil},
+		{
+			name:  "in order",
+			value: "erp-admins=Admin; shop-cashiers = Cashier",
+			want:  [][2]string{{"erp-admins", "Admin"}, {"shop-cashiers", "Cashier"}},
+		},
+		{
+			name:  "incomplete pairs are skipped",
+			value: "erp-admins;=Admin;staff=;shop=Cashier",
+			want:  [][2]string{{"shop", "Cashier"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OIDC_GROUP_ROLES", tt.value)
+			got := GetOidcGroupRoles()
+			if len(got) != len(tt.want) {
+				t.Fatalf("GetOidcGroupRoles() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("GetOidcGroupRoles() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
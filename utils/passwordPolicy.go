@@ -0,0 +1,143 @@
+package utils
+
+import (
+	_ "embed"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+//go:embed commonPasswords.txt
+var commonPasswordsFile string
+
+var commonPasswords = loadCommonPasswords()
+
+type PasswordPolicy struct {
+	MinLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	HistoryCount     int           // number of previous hashes that can't be reused
+	MaxAge           time.Duration // zero disables password expiry
+}
+
+type PasswordRuleViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func loadCommonPasswords() map[string]bool {
+	passwords := make(map[string]bool)
+	for _, line := range strings.Split(commonPasswordsFile, "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line != "" {
+			passwords[line] = true
+		}
+	}
+	return passwords
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// read password policy from env, falling back to defaults
+func GetPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		RequireUppercase: getEnvBool("PASSWORD_REQUIRE_UPPERCASE", true),
+		RequireLowercase: getEnvBool("PASSWORD_REQUIRE_LOWERCASE", true),
+		RequireDigit:     getEnvBool("PASSWORD_REQUIRE_DIGIT", true),
+		RequireSymbol:    getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+		HistoryCount:     getEnvInt("PASSWORD_HISTORY_COUNT", 5),
+		MaxAge:           time.Duration(getEnvInt("PASSWORD_MAX_AGE_DAYS", 0)) * 24 * time.Hour,
+	}
+}
+
+// returns every rule the password fails, empty if it satisfies the policy
+func (policy PasswordPolicy) Check(password string, username string) []PasswordRuleViolation {
+	var violations []PasswordRuleViolation
+
+	if len([]rune(password)) < policy.MinLength {
+		violations = append(violations, PasswordRuleViolation{
+			Rule:    "minLength",
+			Message: "password must be at least " + strconv.Itoa(policy.MinLength) + " characters",
+		})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if policy.RequireUppercase && !hasUpper {
+		violations = append(violations, PasswordRuleViolation{Rule: "uppercase", Message: "password must contain an uppercase letter"})
+	}
+	if policy.RequireLowercase && !hasLower {
+		violations = append(violations, PasswordRuleViolation{Rule: "lowercase", Message: "password must contain a lowercase letter"})
+	}
+	if policy.RequireDigit && !hasDigit {
+		violations = append(violations, PasswordRuleViolation{Rule: "digit", Message: "password must contain a digit"})
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		violations = append(violations, PasswordRuleViolation{Rule: "symbol", Message: "password must contain a symbol"})
+	}
+
+	if commonPasswords[strings.ToLower(password)] {
+		violations = append(violations, PasswordRuleViolation{Rule: "commonPassword", Message: "password is too common"})
+	}
+
+	username = strings.TrimSpace(username)
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		violations = append(violations, PasswordRuleViolation{Rule: "username", Message: "password must not contain the username"})
+	}
+
+	return violations
+}
+
+// check if password changed at given time has expired
+func (policy PasswordPolicy) IsExpired(changedAt *time.Time) bool {
+	if policy.MaxAge <= 0 {
+		return false
+	}
+	if changedAt == nil {
+		return true
+	}
+	return time.Since(*changedAt) > policy.MaxAge
+}
+
+// graphql error listing each failed rule in extensions
+func NewPasswordPolicyError(violations []PasswordRuleViolation) error {
+	return &gqlerror.Error{
+		Message: "password does not meet the password policy",
+		Extensions: map[string]interface{}{
+			"code":       "PASSWORD_POLICY_VIOLATION",
+			"violations": violations,
+		},
+	}
+}
@@ -1,18 +1,59 @@
 package utils
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net/url"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aungmyozaw92/go-graphql/config"
 )
 
-// remove AllowedPaths:Role:id
-func ClearPathsCache(roleId int) error {
-	return config.RemoveRedisKey("AllowedPaths:Role:" + fmt.Sprint(roleId))
+// bumped by ClearPermissionsCache, a role's permissions loaded before aren't stored
+const permissionsVersionKey = "Version:Permissions"
+
+// remove Permissions:Role:id & PermissionVersion:Role:id of roles, once their change is committed
+// not namespaced, role ids are unique across businesses and module changes clear roles of every business
+func ClearPermissionsCache(roleIds ...int) error {
+	if len(roleIds) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(roleIds)*3)
+	for _, roleId := range roleIds {
+		keys = append(keys,
+			"Permissions:Role:"+fmt.Sprint(roleId),
+			"FieldPermissions:Role:"+fmt.Sprint(roleId),
+			"PermissionVersion:Role:"+fmt.Sprint(roleId),
+		)
+	}
+	if err := config.RemoveRedisKey(keys...); err != nil {
+		return err
+	}
+	if _, err := config.GetRedisCounter(context.Background(), permissionsVersionKey); err != nil {
+		// removed once redis is back, loads in between see another version
+		return config.RemoveRedisKey(permissionsVersionKey)
+	}
+	return nil
+}
+
+// read before loading a role's permissions from the database, then passed to StorePermissionsCache
+func GetPermissionsVersion() string {
+	return getCacheVersion(permissionsVersionKey)
+}
+
+// cache a role's permissions loaded at version, unless ClearPermissionsCache ran meanwhile
+// the value may predate the change, the next read loads it again
+func StorePermissionsCache(key string, obj interface{}, version string) error {
+	if getCacheVersion(permissionsVersionKey) != version {
+		return nil
+	}
+	return config.SetRedisObject(key, obj, 0)
 }
 
 func GetCacheLifespan() time.Duration {
@@ -36,64 +77,196 @@ func GetType(i interface{}) string {
 	return reflect.TypeOf(i).Name()
 }
 
+// types with a BusinessId are cached per business, Business:$businessId:Type:$id
+// returns false if ctx has no business, such requests are not cached
+func redisKey[T any](ctx context.Context, key string) (string, bool) {
+	var v T
+	if _, ok := reflect.TypeOf(v).FieldByName("BusinessId"); !ok {
+		return key, true
+	}
+	businessId, ok := GetBusinessIdFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return "Business:" + businessId + ":" + key, true
+}
 
 // store instance, obj should be a pointer
-func StoreRedis[T any](obj any, id int) error {
-	typeName := GetTypeName[T]()
-	key := typeName + ":" + fmt.Sprint(id)
+func StoreRedis[T any](ctx context.Context, obj any, id int) error {
+	key, ok := redisKey[T](ctx, GetTypeName[T]()+":"+fmt.Sprint(id))
+	if !ok {
+		return nil
+	}
 
-	return config.SetRedisObject(key, &obj, GetCacheLifespan())
+	// tagged like LoadRedis, so InvalidateRedis removes it
+	return storeCached(key, obj, RedisTags[T](ctx, id)...)
 }
 
 // store object
-func StoreRedisList[T any](obj any) error {
-	var key string
-	key = GetTypeName[T]() + "List"
-	return config.SetRedisObject(key, &obj,  GetCacheLifespan())
+func StoreRedisList[T any](ctx context.Context, obj any) error {
+	key, ok := redisKey[T](ctx, GetTypeName[T]()+"List")
+	if !ok {
+		return nil
+	}
+	return storeCached(key, obj, RedisTags[T](ctx)...)
 }
 
 // get from redis
-// returns nil if does not exist
-func GetRedis[T any](id int) (*T, error) {
-	var result *T
-	key := GetTypeName[T]() + ":" + fmt.Sprint(id)
-	exists, err := config.GetRedisObject(key, &result)
+// returns nil if does not exist or is stale
+func GetRedis[T any](ctx context.Context, id int) (*T, error) {
+	key, ok := redisKey[T](ctx, GetTypeName[T]()+":"+fmt.Sprint(id))
+	if !ok {
+		return nil, nil
+	}
+	envelope, exists, err := getCached[*T](key)
 	if err != nil {
 		return nil, err
 	}
-	if !exists {
+	if !exists || envelope.stale() {
 		return nil, nil
 	}
-	return result, nil
+	return envelope.Value, nil
 }
 
-// retrieve a list.
-// businessId can be empty
-func GetRedisList[T any]() ([]*T, error) {
-	var key string
-		key = GetTypeName[T]() + "List"
-	
+// retrieve a list of ctx's business
+// returns nil if does not exist or is stale
+func GetRedisList[T any](ctx context.Context) ([]*T, error) {
+	key, ok := redisKey[T](ctx, GetTypeName[T]()+"List")
+	if !ok {
+		return nil, nil
+	}
 
-	var result []*T
-	exists, err := config.GetRedisObject(key, &result)
+	envelope, exists, err := getCached[[]*T](key)
 	if err != nil {
 		return nil, err
 	}
-	if !exists {
+	if !exists || envelope.stale() {
 		return nil, nil
 	}
-	return result, nil
+	return envelope.Value, nil
 }
 
-// remove an instance, Type:$id
-func RemoveRedisItem[T any](id int) error {
-	key := GetTypeName[T]() + ":" + fmt.Sprint(id)
-	return config.RemoveRedisKey(key)
+// tags of T for ctx's business, Type, plus Type:$id for each of ids
+// lists are tagged Type, instances Type:$id, other keys depending on them can be tagged too
+func RedisTags[T any](ctx context.Context, ids ...int) []string {
+	tag, ok := redisKey[T](ctx, GetTypeName[T]())
+	if !ok {
+		return nil
+	}
+	if len(ids) > 0 {
+		tags := make([]string, 0, len(ids))
+		for _, id := range ids {
+			tags = append(tags, tag+":"+fmt.Sprint(id))
+		}
+		return tags
+	}
+	return []string{tag}
+}
+
+// one call per mutation, removes lists of T & instances of ids
+// along with every key tagged with them, and moves filtered lists to a new version
+func InvalidateRedis[T any](ctx context.Context, ids ...int) error {
+	tags := RedisTags[T](ctx)
+	if tags == nil {
+		return nil
+	}
+	if len(ids) > 0 {
+		tags = append(tags, RedisTags[T](ctx, ids...)...)
+	}
+	if err := config.RemoveRedisTags(tags...); err != nil {
+		return err
+	}
+	versionKey, _ := redisVersionKey[T](ctx)
+	if _, err := config.GetRedisCounter(ctx, versionKey); err != nil {
+		// removed once redis is back, the next read starts a new version
+		return config.RemoveRedisKey(versionKey)
+	}
+	return nil
+}
+
+// counter of T for ctx's business, bumped by InvalidateRedis
+func redisVersionKey[T any](ctx context.Context) (string, bool) {
+	return redisKey[T](ctx, "Version:"+GetTypeName[T]())
+}
+
+// version of T's filtered lists for ctx's business, bumped by InvalidateRedis
+// a missing version starts from the current time so lists of an evicted version are never reused
+func getRedisVersion[T any](ctx context.Context) (string, bool) {
+	versionKey, ok := redisVersionKey[T](ctx)
+	if !ok {
+		return "", false
+	}
+	version, exists, err := config.GetRedisValue(versionKey)
+	if err != nil {
+		return "", false
+	}
+	if !exists {
+		version = fmt.Sprint(time.Now().UnixNano())
+		if err := config.SetRedisValue(versionKey, version, 0); err != nil {
+			return "", false
+		}
+	}
+	return version, true
 }
 
-// clear list, TypeList
-func RemoveRedisList[T any]() error {
-	var key string = GetTypeName[T]() + "List"
-	return config.RemoveRedisKey(key)
+// filters with empty ones dropped, strings trimmed & lower cased as LIKE ignores case
+// values may be string, bool, int or pointers to them
+func NormalizeFilters(filters map[string]any) map[string]string {
+	normalized := make(map[string]string, len(filters))
+	for name, value := range filters {
+		switch v := value.(type) {
+		case *string:
+			if v != nil {
+				value = *v
+			} else {
+				value = nil
+			}
+		case *bool:
+			if v != nil {
+				value = *v
+			} else {
+				value = nil
+			}
+		case *int:
+			if v != nil {
+				value = *v
+			} else {
+				value = nil
+			}
+		}
+		switch v := value.(type) {
+		case string:
+			if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+				normalized[name] = v
+			}
+		case bool, int:
+			normalized[name] = fmt.Sprint(v)
+		}
+	}
+	return normalized
 }
 
+// get list of ctx's business matching filters, load is called on a miss
+// the key is derived from the normalised filters, so equal filters share it
+func LoadRedisFilteredList[T any](ctx context.Context, filters map[string]string, load func(ctx context.Context) ([]*T, error)) ([]*T, error) {
+	version, ok := getRedisVersion[T](ctx)
+	if !ok {
+		return load(ctx)
+	}
+	values := url.Values{}
+	for name, value := range filters {
+		values.Set(name, value)
+	}
+	// sorted by name
+	query := values.Encode()
+	if len(query) > 128 {
+		sum := sha256.Sum256([]byte(query))
+		query = hex.EncodeToString(sum[:])
+	}
+	key, ok := redisKey[T](ctx, GetTypeName[T]()+"List:"+version+":"+query)
+	if !ok {
+		return load(ctx)
+	}
+	versionKey, _ := redisVersionKey[T](ctx)
+	return loadCached(ctx, key, versionKey, nil, load)
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+)
+
+func TestStorePermissionsCacheSkipsLoadsRacingAClear(t *testing.T) {
+	config.SetCache(config.NewMemoryCache(100))
+	key := "Permissions:Role:1"
+
+	// loaded before the role's change was committed & cleared
+	version := GetPermissionsVersion()
+	if err := ClearPermissionsCache(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := StorePermissionsCache(key, map[string]bool{"unit:read": true}, version); err != nil {
+		t.Fatal(err)
+	}
+	var permissions map[string]bool
+	if exists, err := config.GetRedisObject(key, &permissions); err != nil || exists {
+		t.Errorf("permissions loaded before the clear are cached: %v, %v", permissions, err)
+	}
+
+	version = GetPermissionsVersion()
+	if err := StorePermissionsCache(key, map[string]bool{"unit:read": true}, version); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := config.GetRedisObject(key, &permissions); err != nil || !exists {
+		t.Errorf("permissions loaded after the clear aren't cached: %v", err)
+	}
+}
@@ -1,46 +1,233 @@
 package utils
 
 import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"math/big"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/golang-jwt/jwt/v5"
 )
 
+const revokedTokenPrefix = "RevokedToken:"
+
+// how long a token found valid in the database is trusted without asking it again
+const tokenNotRevokedLifespan = 30 * time.Second
+
+// user id is carried in sub, PermissionVersion is the hash of the user's role versions when the token was issued
+// ImpersonatorId is the real user of an impersonation token, carried in act.sub
 type JwtCustomClaim struct {
-	ID   int    `json:"id"`
-	Role string `json:"role"`
-	jwt.StandardClaims
+	UserId            int       `json:"-"`
+	ImpersonatorId    int       `json:"-"`
+	Actor             *JwtActor `json:"act,omitempty"`
+	BusinessId        string    `json:"bid"`
+	RoleId            int       `json:"role_id"`
+	Role              string    `json:"role"`
+	PermissionVersion string    `json:"pv"`
+	jwt.RegisteredClaims
+}
+
+// acting party of a token (RFC 8693), the support user behind an impersonation
+type JwtActor struct {
+	Subject string `json:"sub"`
+}
+
+// signing or verification key, identified by kid
+type jwtKey struct {
+	kid        string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer // nil for verification only keys
+	publicKey  crypto.PublicKey
 }
 
-var jwtSecret = []byte(getJwtSecret())
+// json web key, published at /.well-known/jwks.json
+type Jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type Jwks struct {
+	Keys []Jwk `json:"keys"`
+}
+
+var (
+	signingKey *jwtKey
+	verifyKeys map[string]*jwtKey
+)
+
+// load every <kid>.pem in JWT_KEYS_DIR as verification key,
+// JWT_SIGNING_KEY_ID selects the private key used for signing
+func LoadJwtKeys() error {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		return errors.New("JWT_KEYS_DIR is not set")
+	}
+	signingKid := os.Getenv("JWT_SIGNING_KEY_ID")
+	if signingKid == "" {
+		return errors.New("JWT_SIGNING_KEY_ID is not set")
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
 
-func getJwtSecret() string {
-	secret := os.Getenv("API_SECRET")
-	if secret == "" {
-		return "MKitchen-Secret"
+	keys := make(map[string]*jwtKey, len(files))
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		key, err := readJwtKey(kid, file)
+		if err != nil {
+			return fmt.Errorf("jwt key %s: %w", kid, err)
+		}
+		keys[kid] = key
+	}
+
+	signing, ok := keys[signingKid]
+	if !ok {
+		return fmt.Errorf("jwt signing key %s not found in %s", signingKid, dir)
+	}
+	if signing.privateKey == nil {
+		return fmt.Errorf("jwt signing key %s is not a private key", signingKid)
+	}
+
+	signingKey = signing
+	verifyKeys = keys
+	return nil
+}
+
+func readJwtKey(kid string, file string) (*jwtKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid pem")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported pem type %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &jwtKey{kid: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.privateKey, key.publicKey = jwt.SigningMethodRS256, k, k.Public()
+	case ed25519.PrivateKey:
+		key.method, key.privateKey, key.publicKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case *rsa.PublicKey:
+		key.method, key.publicKey = jwt.SigningMethodRS256, k
+	case ed25519.PublicKey:
+		key.method, key.publicKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+	return key, nil
+}
+
+func getJwtIssuer() string {
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		return "go-graphql"
+	}
+	return issuer
+}
+
+func getJwtAudience() string {
+	audience := os.Getenv("JWT_AUDIENCE")
+	if audience == "" {
+		return "go-graphql-api"
+	}
+	return audience
+}
+
+func getJwtClockSkew() time.Duration {
+	skew, err := strconv.Atoi(os.Getenv("JWT_CLOCK_SKEW_SECONDS"))
+	if err != nil {
+		skew = 60
 	}
-	return secret
+	return time.Duration(skew) * time.Second
 }
 
-func JwtGenerate(userID int) (string, error) {
+func newTokenId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// sign claim, registered claims (iss, aud, sub, jti, iat, nbf, exp) are filled in
+func JwtGenerate(claim JwtCustomClaim) (string, error) {
 	token_lifespan, err := strconv.Atoi(os.Getenv("TOKEN_HOUR_LIFESPAN"))
 
+	if err != nil {
+		return "", err
+	}
+	if signingKey == nil {
+		return "", errors.New("jwt signing key is not loaded")
+	}
+	jti, err := newTokenId()
 	if err != nil {
 		return "", err
 	}
 
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, &JwtCustomClaim{
-		ID:   userID,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * time.Duration(token_lifespan)).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
-	})
+	lifespan := time.Hour * time.Duration(token_lifespan)
+	// impersonation tokens are short lived
+	if claim.ImpersonatorId > 0 {
+		claim.Actor = &JwtActor{Subject: strconv.Itoa(claim.ImpersonatorId)}
+		lifespan = GetImpersonationLifespan()
+	}
 
-	token, err := t.SignedString(jwtSecret)
+	now := time.Now()
+	claim.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    getJwtIssuer(),
+		Subject:   strconv.Itoa(claim.UserId),
+		Audience:  jwt.ClaimStrings{getJwtAudience()},
+		ID:        jti,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(lifespan)),
+	}
+
+	t := jwt.NewWithClaims(signingKey.method, &claim)
+	t.Header["kid"] = signingKey.kid
+
+	token, err := t.SignedString(signingKey.privateKey)
 	if err != nil {
 		return "", err
 	}
@@ -48,11 +235,113 @@ func JwtGenerate(userID int) (string, error) {
 	return token, nil
 }
 
-func JwtValidate(token string) (*jwt.Token, error) {
-	return jwt.ParseWithClaims(token, &JwtCustomClaim{}, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+// verify signature, issuer, audience & expiry (with clock skew)
+func JwtValidate(token string) (*JwtCustomClaim, error) {
+	claim := &JwtCustomClaim{}
+	_, err := jwt.ParseWithClaims(token, claim, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := verifyKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if t.Method.Alg() != key.method.Alg() {
 			return nil, fmt.Errorf("there's a problem with the signing method")
 		}
-		return jwtSecret, nil
+		return key.publicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(getJwtIssuer()),
+		jwt.WithAudience(getJwtAudience()),
+		jwt.WithLeeway(getJwtClockSkew()),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claim.ID == "" {
+		return nil, errors.New("token has no jti")
+	}
+	if claim.BusinessId == "" {
+		return nil, errors.New("token has no business")
+	}
+
+	claim.UserId, err = strconv.Atoi(claim.Subject)
+	if err != nil {
+		return nil, errors.New("invalid token subject")
+	}
+	if claim.Actor != nil {
+		claim.ImpersonatorId, err = strconv.Atoi(claim.Actor.Subject)
+		if err != nil || claim.ImpersonatorId == 0 {
+			return nil, errors.New("invalid token actor")
+		}
+	}
+	return claim, nil
+}
+
+// how long a revocation of claim must be kept, until the token expires
+func GetTokenRevocationLifespan(claim *JwtCustomClaim) time.Duration {
+	if claim.ExpiresAt == nil {
+		return time.Hour
+	}
+	return time.Until(claim.ExpiresAt.Time) + getJwtClockSkew()
+}
+
+// blacklist token by jti in the cache until it expires, models.RevokeToken also keeps it in the database
+func RevokeToken(claim *JwtCustomClaim) error {
+	expiration := GetTokenRevocationLifespan(claim)
+	if expiration <= 0 {
+		return nil
+	}
+	return config.GetCache().Set(context.Background(), revokedTokenPrefix+claim.ID, "revoked", expiration)
+}
+
+// whether the cache has jti revoked, known is false on a miss & ErrCacheUnavailable when it can't tell
+func IsTokenRevoked(jti string) (revoked bool, known bool, err error) {
+	value, exists, err := config.GetCache().Get(context.Background(), revokedTokenPrefix+jti)
+	if err != nil || !exists {
+		return false, false, err
+	}
+	return value == "revoked", true, nil
+}
+
+// remember jti wasn't revoked in the database, briefly as the cache may have lost a revocation
+func SetTokenNotRevoked(jti string) error {
+	return config.GetCache().Set(context.Background(), revokedTokenPrefix+jti, "valid", tokenNotRevokedLifespan)
+}
+
+// public verification keys, for other services to verify our tokens
+func GetJwks() Jwks {
+	jwks := Jwks{Keys: make([]Jwk, 0, len(verifyKeys))}
+	for _, key := range verifyKeys {
+		jwk := Jwk{
+			Kid: key.kid,
+			Use: "sig",
+			Alg: key.method.Alg(),
+		}
+		switch pub := key.publicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
 	})
+	return jwks
+}
+
+// lifespan of impersonation tokens, IMPERSONATION_MINUTE_LIFESPAN defaults to 15 minutes
+func GetImpersonationLifespan() time.Duration {
+	lifespan, err := strconv.Atoi(os.Getenv("IMPERSONATION_MINUTE_LIFESPAN"))
+	if err != nil || lifespan <= 0 {
+		lifespan = 15
+	}
+	return time.Duration(lifespan) * time.Minute
 }
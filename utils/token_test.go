@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aungmyozaw92/go-graphql/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestIsTokenRevokedTellsMissesApart(t *testing.T) {
+	config.SetCache(config.NewMemoryCache(100))
+	claim := &JwtCustomClaim{RegisteredClaims: jwt.RegisteredClaims{
+		ID:        "jti-1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}
+
+	// a miss must be checked against the database
+	if revoked, known, err := IsTokenRevoked(claim.ID); err != nil || known || revoked {
+		t.Fatalf("IsTokenRevoked() of a miss = %v, %v, %v", revoked, known, err)
+	}
+
+	if err := SetTokenNotRevoked(claim.ID); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, known, err := IsTokenRevoked(claim.ID); err != nil || !known || revoked {
+		t.Errorf("IsTokenRevoked() of a valid token = %v, %v, %v", revoked, known, err)
+	}
+
+	// a revocation replaces the valid answer
+	if err := RevokeToken(claim); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, known, err := IsTokenRevoked(claim.ID); err != nil || !known || !revoked {
+		t.Errorf("IsTokenRevoked() of a revoked token = %v, %v, %v", revoked, known, err)
+	}
+}
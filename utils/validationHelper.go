@@ -64,6 +64,7 @@ func ValidateResourcesId[M any, ID comparable](ctx context.Context, ids []ID) er
 	return nil
 }
 
+// unique within ctx's business, business_id is added by the tenant scope
 func ValidateUnique[T any](ctx context.Context, column string, value interface{}, exceptId interface{}) error {
 	var count int64
 	var err error